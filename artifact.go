@@ -0,0 +1,312 @@
+package prototype
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+)
+
+// Artifact is a relative path relative to the working directory (see
+// WorkingDir). It cannot go up a directory (i.e. must be within the working
+// directory or any child directories of the working directory). If emitted in
+// the Object of the MessageResponse, Artifacts may be used in pipelines as
+// inputs to other prototypes/tasks/resources.
+//
+// Artifacts may also be used as inputs in objects and requests, in which case
+// they must exist when the payload is decoded. The `file` and `dir` tag
+// options (see WithObject) further constrain the type of the input.
+//
+// Each Artifact in the responses of a message must exist once the handler
+// has returned (or emitted the response). See NewArtifactDir.
+//
+// Artifacts are checked when they are encoded and decoded, and when they are
+// returned (or emitted) by a message handler. An ArtifactPathError is returned
+// if the path is empty, is absolute, goes up a directory, or resolves (through
+// symlinks) to a path outside of the working directory. Only the path itself is
+// checked when encoding, so symlinks are not resolved. Optional Artifact fields
+// should be tagged with omitempty (or be pointers), since an unset Artifact
+// cannot be encoded.
+type Artifact string
+
+func (a Artifact) MarshalJSON() ([]byte, error) {
+	if err := a.checkPath(); err != nil {
+		return nil, err
+	}
+	path := filepath.Clean(string(a))
+	return json.Marshal(map[string]string{"artifact": path})
+}
+
+func (a *Artifact) UnmarshalJSON(payload []byte) error {
+	var dst struct {
+		Artifact string `json:"artifact"`
+		Digest   string `json:"digest"`
+	}
+	dec := json.NewDecoder(bytes.NewReader(payload))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&dst); err != nil {
+		return err
+	}
+	// symlinks are checked once the working directory is known (see
+	// checkInput)
+	artifact := Artifact(dst.Artifact)
+	if err := artifact.checkPath(); err != nil {
+		return err
+	}
+	*a = artifact
+	return nil
+}
+
+type workingDirKey struct{}
+
+// ContextWithWorkingDir returns a copy of ctx in which artifacts are resolved
+// against dir, rather than the working directory of the process. Execute uses
+// the Dir of its Environment.
+func ContextWithWorkingDir(ctx context.Context, dir string) context.Context {
+	return context.WithValue(ctx, workingDirKey{}, dir)
+}
+
+// WorkingDir returns the directory that artifacts are resolved against in ctx
+// (see ContextWithWorkingDir), which defaults to the working directory of the
+// process.
+func WorkingDir(ctx context.Context) string {
+	if dir := workingDir(ctx); dir != "" {
+		return dir
+	}
+	if wd, err := os.Getwd(); err == nil {
+		return wd
+	}
+	return "."
+}
+
+// workingDir returns the working directory of ctx, or "" if it is that of the
+// process.
+func workingDir(ctx context.Context) string {
+	dir, _ := ctx.Value(workingDirKey{}).(string)
+	return dir
+}
+
+// in returns the path of the artifact within dir. If dir is empty, the path is
+// relative to the working directory of the process.
+func (a Artifact) in(dir string) string {
+	return filepath.Join(dir, string(a))
+}
+
+// NewArtifactDir creates a directory (and any missing parents) for an
+// artifact at the given path, relative to the working directory of ctx (see
+// WorkingDir).
+func NewArtifactDir(ctx context.Context, path string) (Artifact, error) {
+	artifact := Artifact(path)
+	dir := workingDir(ctx)
+	if err := artifact.check(dir); err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(artifact.in(dir), 0755); err != nil {
+		return "", err
+	}
+	return artifact, nil
+}
+
+// Path returns the absolute path of the artifact, resolved against the
+// working directory of ctx (see WorkingDir).
+func (a Artifact) Path(ctx context.Context) string {
+	path := a.in(WorkingDir(ctx))
+	if abs, err := filepath.Abs(path); err == nil {
+		return abs
+	}
+	return path
+}
+
+// FS returns a file system rooted at the artifact, which must be a directory.
+// The artifact is resolved against the working directory of ctx (see
+// WorkingDir).
+func (a Artifact) FS(ctx context.Context) fs.FS {
+	return os.DirFS(a.Path(ctx))
+}
+
+// ArtifactPathError is returned when the path of an Artifact is not within
+// the working directory.
+type ArtifactPathError struct {
+	// The path of the artifact.
+	Path string
+
+	// Why the path was rejected.
+	Reason string
+}
+
+func (e ArtifactPathError) Error() string {
+	return fmt.Sprintf("invalid artifact path %q: %s", e.Path, e.Reason)
+}
+
+// checkInput checks that an artifact decoded from an object or request is
+// within dir, exists, and satisfies the file or dir options of its field's tag.
+// It returns a human readable reason if it does not. Unset artifacts are not
+// checked, since the required option covers their presence.
+func (a Artifact) checkInput(dir string, tag fieldTag) (string, bool) {
+	if a == "" {
+		return "", true
+	}
+	if err := a.check(dir); err != nil {
+		return err.Error(), false
+	}
+	info, err := os.Stat(a.in(dir))
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return fmt.Sprintf("artifact %q does not exist", string(a)), false
+		}
+		return err.Error(), false
+	}
+	if tag.file && !info.Mode().IsRegular() {
+		return fmt.Sprintf("artifact %q must be a file", string(a)), false
+	}
+	if tag.dir && !info.IsDir() {
+		return fmt.Sprintf("artifact %q must be a directory", string(a)), false
+	}
+	return "", true
+}
+
+// isArtifactField returns whether the field is an Artifact, or a pointer,
+// slice, array or map of Artifacts.
+func isArtifactField(rt reflect.Type) bool {
+	for {
+		switch rt.Kind() {
+		case reflect.Ptr, reflect.Slice, reflect.Array, reflect.Map:
+			rt = rt.Elem()
+		default:
+			return rt == artifactType
+		}
+	}
+}
+
+// verifyArtifacts returns an ArtifactPathError if any Artifact in the
+// responses is invalid or does not exist within dir.
+func verifyArtifacts(dir string, responses ...MessageResponse) error {
+	for _, response := range responses {
+		err := walkArtifacts(reflect.ValueOf(response.Object), func(a Artifact) error {
+			if err := a.check(dir); err != nil {
+				return err
+			}
+			if _, err := os.Stat(a.in(dir)); err != nil {
+				return ArtifactPathError{Path: string(a), Reason: "does not exist"}
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// walkArtifacts calls fn with each Artifact that would be encoded as part of
+// rv.
+func walkArtifacts(rv reflect.Value, fn func(Artifact) error) error {
+	switch rv.Kind() {
+	case reflect.Interface, reflect.Ptr:
+		if rv.IsNil() {
+			return nil
+		}
+		return walkArtifacts(rv.Elem(), fn)
+	case reflect.String:
+		if rv.Type() == artifactType {
+			return fn(Artifact(rv.String()))
+		}
+	case reflect.Struct:
+		for i := 0; i < rv.NumField(); i++ {
+			if !rv.Type().Field(i).IsExported() {
+				continue
+			}
+			if err := walkArtifacts(rv.Field(i), fn); err != nil {
+				return err
+			}
+		}
+	case reflect.Map:
+		iter := rv.MapRange()
+		for iter.Next() {
+			if err := walkArtifacts(iter.Value(), fn); err != nil {
+				return err
+			}
+		}
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < rv.Len(); i++ {
+			if err := walkArtifacts(rv.Index(i), fn); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// checkPath returns an ArtifactPathError if the path of the artifact is empty,
+// absolute, or goes up a directory. It does not access the filesystem.
+func (a Artifact) checkPath() error {
+	path := string(a)
+	invalid := func(reason string) error {
+		return ArtifactPathError{Path: path, Reason: reason}
+	}
+	if path == "" {
+		return invalid("must not be empty")
+	}
+	if filepath.IsAbs(path) {
+		return invalid("must be relative to the working directory")
+	}
+	if escapes(filepath.Clean(path)) {
+		return invalid("must not go up a directory")
+	}
+	return nil
+}
+
+// check returns an ArtifactPathError if the artifact is not within dir (or the
+// working directory of the process, if dir is empty). Symlinks are only
+// checked for the parts of the path that exist.
+func (a Artifact) check(dir string) error {
+	if err := a.checkPath(); err != nil {
+		return err
+	}
+	path := string(a)
+	invalid := func(reason string) error {
+		return ArtifactPathError{Path: path, Reason: reason}
+	}
+	clean := filepath.Clean(path)
+
+	wd, err := filepath.Abs(dir)
+	if err != nil {
+		return fmt.Errorf("get working directory: %w", err)
+	}
+	root, err := filepath.EvalSymlinks(wd)
+	if err != nil {
+		return fmt.Errorf("resolve working directory: %w", err)
+	}
+
+	// resolve the longest part of the path that exists
+	for existing := clean; ; existing = filepath.Dir(existing) {
+		resolved, err := filepath.EvalSymlinks(filepath.Join(wd, existing))
+		if err == nil {
+			rel, err := filepath.Rel(root, resolved)
+			if err != nil || escapes(rel) {
+				return invalid("resolves to a path outside of the working directory")
+			}
+			return nil
+		}
+		if !errors.Is(err, fs.ErrNotExist) {
+			return fmt.Errorf("resolve artifact %q: %w", path, err)
+		}
+		if _, err := os.Lstat(filepath.Join(wd, existing)); err == nil {
+			return invalid("contains a symlink that cannot be resolved")
+		}
+		if existing == "." {
+			return nil
+		}
+	}
+}
+
+// escapes returns whether a clean relative path goes up a directory.
+func escapes(path string) bool {
+	return path == ".." || strings.HasPrefix(path, ".."+string(filepath.Separator))
+}
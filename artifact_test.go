@@ -0,0 +1,353 @@
+package prototype_test
+
+import (
+	"context"
+	"encoding/json"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/aoldershaw/prototype-sdk-go"
+	"github.com/stretchr/testify/require"
+)
+
+// inTempDir changes the working directory to a temporary directory for the
+// duration of the test.
+func inTempDir(t *testing.T) string {
+	dir := t.TempDir()
+	wd, err := os.Getwd()
+	require.NoError(t, err)
+	require.NoError(t, os.Chdir(dir))
+	t.Cleanup(func() { os.Chdir(wd) })
+	return dir
+}
+
+func TestArtifactPathSafety(t *testing.T) {
+	outside := t.TempDir()
+	inTempDir(t)
+	require.NoError(t, os.Mkdir("dir", 0755))
+	require.NoError(t, os.Symlink("dir", "inside-link"))
+	require.NoError(t, os.Symlink(outside, "outside-link"))
+	require.NoError(t, os.Symlink(filepath.Join(outside, "missing"), "dangling-link"))
+
+	for _, tt := range []struct {
+		path   string
+		valid  bool
+		reason string
+		// symlinks are only resolved once the working directory is known, so
+		// the path still unmarshals
+		symlink bool
+	}{
+		{path: "image", valid: true},
+		{path: "./dir/image", valid: true},
+		{path: "dir/../image", valid: true},
+		{path: "inside-link/image", valid: true},
+		{path: "", reason: "must not be empty"},
+		{path: "/etc/passwd", reason: "must be relative to the working directory"},
+		{path: "../image", reason: "must not go up a directory"},
+		{path: "dir/../../etc", reason: "must not go up a directory"},
+		{path: "outside-link", reason: "resolves to a path outside of the working directory", symlink: true},
+		{path: "outside-link/missing/image", reason: "resolves to a path outside of the working directory", symlink: true},
+		{path: "dangling-link", reason: "contains a symlink that cannot be resolved", symlink: true},
+	} {
+		t.Run(tt.path, func(t *testing.T) {
+			proto := prototype.New(
+				prototype.WithObject(SimpleObject{},
+					prototype.WithMessage("msg", func(SimpleObject) []prototype.MessageResponse {
+						return []prototype.MessageResponse{{Object: map[string]interface{}{"image": prototype.Artifact(tt.path)}}}
+					}),
+				))
+			_, runErr := proto.Run("msg", prototype.MessageRequest{Object: map[string]interface{}{"foo": "bar"}})
+
+			var unmarshaled prototype.Artifact
+			unmarshalErr := json.Unmarshal([]byte(`{"artifact":"`+tt.path+`"}`), &unmarshaled)
+			if tt.valid {
+				var pathErr prototype.ArtifactPathError
+				require.ErrorAs(t, runErr, &pathErr)
+				require.Equal(t, "does not exist", pathErr.Reason)
+				require.NoError(t, unmarshalErr)
+				require.Equal(t, prototype.Artifact(tt.path), unmarshaled)
+				return
+			}
+
+			var pathErr prototype.ArtifactPathError
+			require.ErrorAs(t, runErr, &pathErr)
+			require.Equal(t, tt.path, pathErr.Path)
+			require.Equal(t, tt.reason, pathErr.Reason)
+			require.Equal(t, prototype.ErrorCodeHandler, prototype.AsError(runErr).Code)
+			if !tt.symlink {
+				require.ErrorAs(t, unmarshalErr, &pathErr)
+				return
+			}
+			require.NoError(t, unmarshalErr)
+
+			type Input struct {
+				Image prototype.Artifact `json:"image"`
+			}
+			proto = prototype.New(
+				prototype.WithObject(Input{},
+					prototype.WithMessage("msg", noop),
+				))
+			_, runErr = proto.Run("msg", prototype.MessageRequest{Object: map[string]interface{}{
+				"image": map[string]interface{}{"artifact": tt.path},
+			}})
+			protoErr := prototype.AsError(runErr)
+			require.Equal(t, prototype.ErrorCodeNoMatch, protoErr.Code)
+			require.Contains(t, protoErr.Message, tt.reason)
+		})
+	}
+}
+
+func TestArtifactMarshal(t *testing.T) {
+	for _, tt := range []struct {
+		path     string
+		expected string
+		reason   string
+	}{
+		{path: "image", expected: `{"artifact":"image"}`},
+		{path: "./dir/image", expected: `{"artifact":"dir/image"}`},
+		{path: "", reason: "must not be empty"},
+		{path: "/etc/passwd", reason: "must be relative to the working directory"},
+		{path: "../../etc", reason: "must not go up a directory"},
+		{path: "dir/../..", reason: "must not go up a directory"},
+	} {
+		payload, err := json.Marshal(prototype.Artifact(tt.path))
+		if tt.reason != "" {
+			var pathErr prototype.ArtifactPathError
+			require.ErrorAs(t, err, &pathErr, tt.path)
+			require.Equal(t, prototype.ArtifactPathError{Path: tt.path, Reason: tt.reason}, pathErr)
+			continue
+		}
+		require.NoError(t, err)
+		require.JSONEq(t, tt.expected, string(payload))
+	}
+
+	// an unset artifact does not prevent the object from being decoded
+	type Image struct {
+		Name  string             `json:"name" prototype:"required"`
+		Cache prototype.Artifact `json:"cache"`
+	}
+	proto := prototype.New(
+		prototype.WithObject(Image{},
+			prototype.WithMessage("msg", noop),
+		))
+	_, err := proto.Run("msg", prototype.MessageRequest{Object: map[string]interface{}{"name": "image"}})
+	require.NoError(t, err)
+}
+
+func TestArtifactPathSafetyDecode(t *testing.T) {
+	type Output struct {
+		Image prototype.Artifact `json:"image"`
+	}
+	proto := prototype.New(
+		prototype.WithObject(Output{},
+			prototype.WithMessage("msg", noop),
+		))
+
+	_, err := proto.Run("msg", prototype.MessageRequest{Object: map[string]interface{}{
+		"image": map[string]interface{}{"artifact": "../image"},
+	}})
+	var noMatchErr prototype.NoMatchError
+	require.ErrorAs(t, err, &noMatchErr)
+	require.Contains(t, noMatchErr.Error(), "must not go up a directory")
+}
+
+func TestArtifactHelpers(t *testing.T) {
+	dir := inTempDir(t)
+	ctx := context.Background()
+
+	artifact, err := prototype.NewArtifactDir(ctx, "out/image")
+	require.NoError(t, err)
+	require.DirExists(t, filepath.Join(dir, "out", "image"))
+
+	resolved, err := filepath.EvalSymlinks(artifact.Path(ctx))
+	require.NoError(t, err)
+	expected, err := filepath.EvalSymlinks(filepath.Join(dir, "out", "image"))
+	require.NoError(t, err)
+	require.Equal(t, expected, resolved)
+
+	require.NoError(t, os.WriteFile(filepath.Join("out", "image", "layer"), []byte("contents"), 0644))
+	contents, err := fs.ReadFile(artifact.FS(ctx), "layer")
+	require.NoError(t, err)
+	require.Equal(t, "contents", string(contents))
+
+	_, err = prototype.NewArtifactDir(ctx, "../image")
+	var pathErr prototype.ArtifactPathError
+	require.ErrorAs(t, err, &pathErr)
+}
+
+func TestArtifactWorkingDir(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "context"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "context", "Dockerfile"), []byte("FROM scratch"), 0644))
+
+	type Image struct {
+		Context prototype.Artifact `json:"context" prototype:"required,dir"`
+	}
+	proto := prototype.New(
+		prototype.WithArtifactDigests(),
+		prototype.WithObject(Image{},
+			prototype.WithMessage("build", func(ctx context.Context, image Image) ([]prototype.MessageResponse, error) {
+				if _, err := fs.Stat(image.Context.FS(ctx), "Dockerfile"); err != nil {
+					return nil, err
+				}
+				output, err := prototype.NewArtifactDir(ctx, "image")
+				if err != nil {
+					return nil, err
+				}
+				return []prototype.MessageResponse{{Object: map[string]interface{}{"image": output}}}, nil
+			}),
+		))
+	request := prototype.MessageRequest{Object: map[string]interface{}{
+		"context": map[string]interface{}{"artifact": "context"},
+	}}
+
+	// the working directory of the process is unaffected
+	_, err := proto.Run("build", request)
+	require.Equal(t, prototype.ErrorCodeNoMatch, prototype.AsError(err).Code)
+
+	ctx := prototype.ContextWithWorkingDir(context.Background(), dir)
+	require.Equal(t, dir, prototype.WorkingDir(ctx))
+	responses, err := proto.RunContext(ctx, "build", request)
+	require.NoError(t, err)
+	require.Equal(t, []prototype.MessageResponse{{Object: map[string]interface{}{"image": prototype.Artifact("image")}}}, responses)
+	require.DirExists(t, filepath.Join(dir, "image"))
+	require.Equal(t, filepath.Join(dir, "image"), prototype.Artifact("image").Path(ctx))
+
+	digest, err := prototype.Artifact("context").Digest(ctx)
+	require.NoError(t, err)
+	_, err = proto.RunContext(ctx, "build", prototype.MessageRequest{Object: map[string]interface{}{
+		"context": map[string]interface{}{"artifact": "context", "digest": digest},
+	}})
+	require.NoError(t, err)
+}
+
+func TestArtifactsMustExist(t *testing.T) {
+	inTempDir(t)
+	require.NoError(t, os.Mkdir("exists", 0755))
+
+	type Output struct {
+		Layers []prototype.Artifact `json:"layers"`
+	}
+	proto := prototype.New(
+		prototype.WithObject(SimpleObject{},
+			prototype.WithMessage("msg", func(object SimpleObject) []prototype.MessageResponse {
+				return []prototype.MessageResponse{{Object: map[string]interface{}{
+					"image":  prototype.Artifact("exists"),
+					"output": Output{Layers: []prototype.Artifact{prototype.Artifact(object.Foo)}},
+				}}}
+			}),
+			prototype.WithMessage("stream", func(object SimpleObject, emitter prototype.Emitter) error {
+				return emitter.Emit(prototype.MessageResponse{Object: map[string]interface{}{
+					"image": prototype.Artifact(object.Foo),
+				}})
+			}),
+		))
+
+	_, err := proto.Run("msg", prototype.MessageRequest{Object: map[string]interface{}{"foo": "exists"}})
+	require.NoError(t, err)
+
+	for _, message := range []string{"msg", "stream"} {
+		var emitted []prototype.MessageResponse
+		err = proto.RunEmit(context.Background(), message, prototype.MessageRequest{Object: map[string]interface{}{"foo": "missing"}},
+			prototype.EmitterFunc(func(response prototype.MessageResponse) error {
+				emitted = append(emitted, response)
+				return nil
+			}))
+		var pathErr prototype.ArtifactPathError
+		require.ErrorAs(t, err, &pathErr)
+		require.Equal(t, prototype.ArtifactPathError{Path: "missing", Reason: "does not exist"}, pathErr)
+		require.Equal(t, prototype.ErrorCodeHandler, prototype.AsError(err).Code)
+		require.Empty(t, emitted)
+	}
+}
+
+func TestArtifactInputs(t *testing.T) {
+	inTempDir(t)
+	require.NoError(t, os.Mkdir("context", 0755))
+	require.NoError(t, os.WriteFile(filepath.Join("context", "Dockerfile"), []byte("FROM scratch"), 0644))
+
+	type Image struct {
+		Context    prototype.Artifact            `json:"context" prototype:"required,dir"`
+		Dockerfile *prototype.Artifact           `json:"dockerfile,omitempty" prototype:"file"`
+		Inputs     map[string]prototype.Artifact `json:"inputs,omitempty"`
+		Cache      prototype.Artifact            `json:"cache,omitempty" prototype:"dir"`
+	}
+	proto := prototype.New(
+		prototype.WithObject(Image{},
+			prototype.WithMessage("build", func(ctx context.Context, image Image) ([]prototype.MessageResponse, error) {
+				contents, err := fs.ReadFile(image.Context.FS(ctx), "Dockerfile")
+				if err != nil {
+					return nil, err
+				}
+				return []prototype.MessageResponse{{Object: map[string]interface{}{"dockerfile": string(contents)}}}, nil
+			}),
+		))
+
+	artifact := func(path string) map[string]interface{} {
+		return map[string]interface{}{"artifact": path}
+	}
+	for _, tt := range []struct {
+		desc   string
+		object map[string]interface{}
+		field  string
+		reason string
+	}{
+		{
+			desc:   "missing",
+			object: map[string]interface{}{"context": artifact("missing")},
+			field:  "context",
+			reason: `artifact "missing" does not exist`,
+		},
+		{
+			desc:   "not a directory",
+			object: map[string]interface{}{"context": artifact("context/Dockerfile")},
+			field:  "context",
+			reason: `artifact "context/Dockerfile" must be a directory`,
+		},
+		{
+			desc:   "not a file",
+			object: map[string]interface{}{"context": artifact("context"), "dockerfile": artifact("context")},
+			field:  "dockerfile",
+			reason: `artifact "context" must be a file`,
+		},
+		{
+			desc:   "missing in map",
+			object: map[string]interface{}{"context": artifact("context"), "inputs": map[string]interface{}{"a": artifact("missing")}},
+			field:  "inputs",
+			reason: `artifact "missing" does not exist`,
+		},
+	} {
+		t.Run(tt.desc, func(t *testing.T) {
+			_, err := proto.Run("build", prototype.MessageRequest{Object: tt.object})
+			protoErr := prototype.AsError(err)
+			require.Equal(t, prototype.ErrorCodeNoMatch, protoErr.Code)
+			require.Equal(t, tt.field, protoErr.Field)
+			require.Contains(t, protoErr.Message, tt.reason)
+		})
+	}
+
+	// optional artifacts may be omitted
+	responses, err := proto.Run("build", prototype.MessageRequest{Object: map[string]interface{}{
+		"context": artifact("context"),
+	}})
+	require.NoError(t, err)
+	require.Equal(t, []prototype.MessageResponse{{Object: map[string]interface{}{"dockerfile": "FROM scratch"}}}, responses)
+
+	responses, err = proto.Run("build", prototype.MessageRequest{Object: map[string]interface{}{
+		"context":    artifact("context"),
+		"dockerfile": artifact("context/Dockerfile"),
+		"inputs":     map[string]interface{}{"a": artifact("context")},
+		"cache":      artifact("context"),
+	}})
+	require.NoError(t, err)
+	require.Equal(t, []prototype.MessageResponse{{Object: map[string]interface{}{"dockerfile": "FROM scratch"}}}, responses)
+
+	require.Panics(t, func() {
+		type Invalid struct {
+			Path string `json:"path" prototype:"dir"`
+		}
+		prototype.WithObject(Invalid{})
+	})
+}
@@ -0,0 +1,153 @@
+package prototype
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// BatchRequest is a single request in the input to RunBatch.
+type BatchRequest struct {
+	// An optional identifier for the request, which is echoed in the
+	// BatchResponse. May be any JSON value.
+	ID json.RawMessage `json:"id,omitempty"`
+
+	// The message to run.
+	Message string `json:"message"`
+
+	// The object to act on.
+	Object map[string]interface{} `json:"object"`
+}
+
+// BatchResponse is written by RunBatch for each BatchRequest.
+type BatchResponse struct {
+	// The ID of the BatchRequest, if it had one.
+	ID json.RawMessage `json:"id,omitempty"`
+
+	// The position of the BatchRequest in the input, starting from 0.
+	Index int `json:"index"`
+
+	// The responses returned by the message.
+	Responses []MessageResponse `json:"responses"`
+
+	// The failure, if the request failed.
+	Error *Error `json:"error,omitempty"`
+}
+
+type batchConfig struct {
+	workers int
+}
+
+// BatchOption configures RunBatch.
+type BatchOption func(*batchConfig)
+
+// WithBatchWorkers configures how many requests RunBatch runs in parallel.
+// The default is 1.
+func WithBatchWorkers(workers int) BatchOption {
+	return func(c *batchConfig) {
+		if workers > 0 {
+			c.workers = workers
+		}
+	}
+}
+
+// RunBatch reads a stream of newline-delimited BatchRequests from r, runs each
+// of them (see RunContext), and writes a newline-delimited BatchResponse to w
+// for each request. Responses are written in the same order as the requests,
+// even when requests are run in parallel (see WithBatchWorkers).
+//
+// A request that fails (including one that cannot be decoded) results in a
+// BatchResponse with an Error. RunBatch itself only fails if the requests
+// cannot be read or the responses cannot be written.
+func (p Prototype) RunBatch(ctx context.Context, r io.Reader, w io.Writer, options ...BatchOption) error {
+	config := batchConfig{workers: 1}
+	for _, opt := range options {
+		opt(&config)
+	}
+
+	// pending holds the results in the order of the requests. Its capacity
+	// (along with the semaphore) bounds the number of buffered responses.
+	pending := make(chan chan BatchResponse, config.workers)
+	written := make(chan error, 1)
+	go func() {
+		encoder := json.NewEncoder(w)
+		var err error
+		for result := range pending {
+			response := <-result
+			if err != nil {
+				continue
+			}
+			err = encoder.Encode(response)
+		}
+		written <- err
+	}()
+
+	var wg sync.WaitGroup
+	semaphore := make(chan struct{}, config.workers)
+	reader := bufio.NewReader(r)
+	var readErr error
+	for index := 0; ; {
+		line, err := reader.ReadBytes('\n')
+		if len(bytes.TrimSpace(line)) > 0 {
+			result := make(chan BatchResponse, 1)
+			pending <- result
+			semaphore <- struct{}{}
+			wg.Add(1)
+			go func(index int, line []byte) {
+				defer wg.Done()
+				defer func() { <-semaphore }()
+				result <- p.runBatchRequest(ctx, index, line)
+			}(index, line)
+			index++
+		}
+		if err != nil {
+			if !errors.Is(err, io.EOF) {
+				readErr = &Error{Code: ErrorCodeInvalidRequest, Message: fmt.Sprintf("read requests: %s", err), err: err}
+			}
+			break
+		}
+	}
+	wg.Wait()
+	close(pending)
+
+	if err := <-written; err != nil {
+		return &Error{Code: ErrorCodeInternal, Message: fmt.Sprintf("write response: %s", err), err: err}
+	}
+	return readErr
+}
+
+func (p Prototype) runBatchRequest(ctx context.Context, index int, line []byte) BatchResponse {
+	var request BatchRequest
+	if err := json.Unmarshal(line, &request); err != nil {
+		return BatchResponse{
+			Index: index,
+			Error: &Error{Code: ErrorCodeInvalidRequest, Message: fmt.Sprintf("invalid json request: %s", err), err: err},
+		}
+	}
+	response := BatchResponse{ID: request.ID, Index: index, Responses: []MessageResponse{}}
+	if request.Message == "" {
+		response.Error = &Error{Code: ErrorCodeInvalidRequest, Message: "missing message"}
+		return response
+	}
+	responses, err := p.RunContext(ctx, request.Message, MessageRequest{Object: request.Object})
+	if err != nil {
+		response.Error = AsError(fmt.Errorf("run %q: %w", request.Message, err))
+		return response
+	}
+	for _, r := range responses {
+		if p.artifactDigests {
+			if r, err = addArtifactDigests(workingDir(ctx), r); err != nil {
+				response.Error = &Error{Code: ErrorCodeHandler, Message: fmt.Sprintf("digest artifacts: %s", err), err: err}
+				response.Responses = []MessageResponse{}
+				return response
+			}
+		}
+		response.Responses = append(response.Responses, r)
+	}
+	return response
+}
@@ -0,0 +1,72 @@
+package prototype_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/aoldershaw/prototype-sdk-go"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPrototypeRunBatch(t *testing.T) {
+	var running, maxRunning int32
+	proto := prototype.New(
+		prototype.WithObject(SimpleObject{},
+			prototype.WithMessage("msg", func(object SimpleObject) []prototype.MessageResponse {
+				n := atomic.AddInt32(&running, 1)
+				defer atomic.AddInt32(&running, -1)
+				for {
+					max := atomic.LoadInt32(&maxRunning)
+					if n <= max || atomic.CompareAndSwapInt32(&maxRunning, max, n) {
+						break
+					}
+				}
+				// later requests finish first
+				time.Sleep(time.Duration(10-object.Bar) * time.Millisecond)
+				return []prototype.MessageResponse{{Object: map[string]interface{}{"bar": object.Bar}}}
+			}),
+		),
+	)
+
+	input := strings.Join([]string{
+		`{"id": "a", "message": "msg", "object": {"foo": "x", "bar": 1}}`,
+		``,
+		`{"id": 2, "message": "msg", "object": {"foo": "x", "bar": 2}}`,
+		`{"message": "msg", "object": {"bar": 3}}`,
+		`not json`,
+		`{"message": "msg", "object": {"foo": "x", "bar": 5}}`,
+	}, "\n")
+
+	for _, workers := range []int{1, 3} {
+		var out bytes.Buffer
+		maxRunning = 0
+		err := proto.RunBatch(context.Background(), strings.NewReader(input), &out, prototype.WithBatchWorkers(workers))
+		require.NoError(t, err)
+		require.LessOrEqual(t, int(maxRunning), workers)
+
+		var responses []prototype.BatchResponse
+		decoder := json.NewDecoder(&out)
+		for decoder.More() {
+			var response prototype.BatchResponse
+			require.NoError(t, decoder.Decode(&response))
+			responses = append(responses, response)
+		}
+		require.Len(t, responses, 5)
+
+		for i, response := range responses {
+			require.Equal(t, i, response.Index)
+		}
+		require.JSONEq(t, `"a"`, string(responses[0].ID))
+		require.Equal(t, []prototype.MessageResponse{{Object: map[string]interface{}{"bar": 1.0}}}, responses[0].Responses)
+		require.JSONEq(t, `2`, string(responses[1].ID))
+		require.Nil(t, responses[1].Error)
+		require.Equal(t, prototype.ErrorCodeNoMatch, responses[2].Error.Code)
+		require.Equal(t, prototype.ErrorCodeInvalidRequest, responses[3].Error.Code)
+		require.Nil(t, responses[4].Error)
+	}
+}
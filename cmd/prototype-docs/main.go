@@ -0,0 +1,75 @@
+// Command prototype-docs generates reference documentation for a prototype
+// from its definition (see Prototype.GenerateDocs).
+//
+// Usage:
+//
+//	prototype-docs [-format markdown|html] [-o file] [package | binary]
+//
+// The target is either a main package of a prototype (which is built with
+// `go build`) or a built prototype binary. The prototype must call Execute (or
+// Main). If no target is given, the package in the current directory is
+// documented. The documentation is written to stdout, unless -o is given.
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+
+	prototype "github.com/aoldershaw/prototype-sdk-go"
+	"github.com/aoldershaw/prototype-sdk-go/internal/prototypebin"
+)
+
+func main() {
+	flags := flag.NewFlagSet("prototype-docs", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "usage: prototype-docs [-format markdown|html] [-o file] [package | binary]")
+		flags.PrintDefaults()
+	}
+	format := flags.String("format", string(prototype.DocsMarkdown), "format of the documentation (markdown or html)")
+	output := flags.String("o", "", "write the documentation to `file` rather than stdout")
+	flags.Parse(os.Args[1:])
+	if flags.NArg() > 1 {
+		flags.Usage()
+		os.Exit(2)
+	}
+	target := "."
+	if flags.NArg() == 1 {
+		target = flags.Arg(0)
+	}
+
+	docs, err := generate(target, *format)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "prototype-docs: %s\n", err)
+		os.Exit(1)
+	}
+	if *output == "" {
+		os.Stdout.Write(docs)
+		return
+	}
+	if err := os.WriteFile(*output, docs, 0644); err != nil {
+		fmt.Fprintf(os.Stderr, "prototype-docs: %s\n", err)
+		os.Exit(1)
+	}
+}
+
+func generate(target, format string) ([]byte, error) {
+	binary, cleanup, err := prototypebin.Build(target)
+	if err != nil {
+		return nil, err
+	}
+	defer cleanup()
+
+	var stderr bytes.Buffer
+	cmd := exec.Command(binary, "--docs", "--format="+format)
+	cmd.Stderr = &stderr
+	docs, err := cmd.Output()
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		return nil, fmt.Errorf("%w\n%s", err, stderr.Bytes())
+	}
+	return docs, err
+}
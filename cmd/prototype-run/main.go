@@ -0,0 +1,437 @@
+// Command prototype-run runs messages of a prototype locally, the way that
+// Concourse would invoke it, without requiring a Concourse deployment.
+//
+// Usage:
+//
+//	prototype-run [flags] (package | binary) [message]...
+//
+// The target is either a main package of a prototype (which is built with
+// `go build`) or a built prototype binary. The object is read from the file
+// given by -object (or stdin, if it is "-"), and may be written as YAML or
+// JSON.
+//
+// The prototype is run in a scratch working directory, into which the inputs
+// given by -input are copied. Each request is written to the prototype's
+// stdin along with a `response_path`, and the responses written there are
+// printed along with a summary of the artifacts they reference.
+//
+// If no messages are given, an InfoRequest is sent. If multiple messages are
+// given, they are run in order, and the object of a response of each message
+// is used as the object for the next (see -pick and -merge). Artifacts
+// produced by one message are available to the next, since they share the
+// working directory.
+//
+// If a request fails, prototype-run exits with the exit code of the
+// prototype.
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	prototype "github.com/aoldershaw/prototype-sdk-go"
+	"github.com/aoldershaw/prototype-sdk-go/internal/prototypebin"
+	"gopkg.in/yaml.v3"
+)
+
+// inputs is a flag that collects name=path pairs.
+type inputs map[string]string
+
+func (i inputs) String() string {
+	var pairs []string
+	for name, path := range i {
+		pairs = append(pairs, name+"="+path)
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
+
+func (i inputs) Set(value string) error {
+	name, path, ok := strings.Cut(value, "=")
+	if !ok || name == "" || path == "" {
+		return fmt.Errorf("expected name=path, got %q", value)
+	}
+	i[name] = path
+	return nil
+}
+
+type runner struct {
+	binary  string
+	workDir string
+	pick    int
+	merge   bool
+	stdout  io.Writer
+}
+
+func main() {
+	in := inputs{}
+	flags := flag.NewFlagSet("prototype-run", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "usage: prototype-run [flags] (package | binary) [message]...")
+		flags.PrintDefaults()
+	}
+	objectPath := flags.String("object", "", "path to the object as YAML or JSON, or - for stdin (default: an empty object)")
+	flags.Var(in, "input", "copy an artifact into the working directory, as `name=path` (may be repeated)")
+	workDir := flags.String("workdir", "", "the working directory to run in (default: a new temporary directory)")
+	pick := flags.Int("pick", -1, "when chaining messages, the index of the response whose object is used for the next message (default: require exactly one response)")
+	merge := flags.Bool("merge", false, "when chaining messages, merge the response object over the previous object")
+	flags.Parse(os.Args[1:])
+	if flags.NArg() == 0 {
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	if err := run(flags.Arg(0), flags.Args()[1:], *objectPath, in, *workDir, *pick, *merge); err != nil {
+		fmt.Fprintf(os.Stderr, "prototype-run: %s\n", err)
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			os.Exit(exitErr.ExitCode())
+		}
+		os.Exit(1)
+	}
+}
+
+func run(target string, messages []string, objectPath string, in inputs, workDir string, pick int, merge bool) error {
+	object, err := readObject(objectPath)
+	if err != nil {
+		return fmt.Errorf("read object: %w", err)
+	}
+
+	binary, cleanup, err := prototypebin.Build(target)
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+
+	if workDir == "" {
+		if workDir, err = os.MkdirTemp("", "prototype-run"); err != nil {
+			return err
+		}
+	} else if err := os.MkdirAll(workDir, 0755); err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "working directory: %s\n", workDir)
+	for name, path := range in {
+		if err := copyInput(path, filepath.Join(workDir, name)); err != nil {
+			return fmt.Errorf("copy input %q: %w", name, err)
+		}
+	}
+
+	r := runner{binary: binary, workDir: workDir, pick: pick, merge: merge, stdout: os.Stdout}
+	if len(messages) == 0 {
+		return r.info(object)
+	}
+	for i, message := range messages {
+		responses, err := r.message(message, object)
+		if err != nil {
+			return err
+		}
+		if i == len(messages)-1 {
+			break
+		}
+		next, err := r.chain(message, object, responses)
+		if err != nil {
+			return err
+		}
+		object = next
+	}
+	return nil
+}
+
+// readObject reads an object from the YAML or JSON file at path. Since JSON is
+// a subset of YAML, the file is always decoded as YAML.
+func readObject(path string) (map[string]interface{}, error) {
+	if path == "" {
+		return map[string]interface{}{}, nil
+	}
+	var payload []byte
+	var err error
+	if path == "-" {
+		payload, err = io.ReadAll(os.Stdin)
+	} else {
+		payload, err = os.ReadFile(path)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var raw interface{}
+	if err := yaml.Unmarshal(payload, &raw); err != nil {
+		return nil, err
+	}
+	if raw == nil {
+		return map[string]interface{}{}, nil
+	}
+	// round trip through JSON to normalize the decoded values
+	normalized, err := json.Marshal(raw)
+	if err != nil {
+		return nil, err
+	}
+	var object map[string]interface{}
+	if err := json.Unmarshal(normalized, &object); err != nil {
+		return nil, errors.New("object must be a mapping")
+	}
+	return object, nil
+}
+
+// invoke runs the prototype in the working directory, and returns the raw
+// contents of the `response_path`. Output of the prototype is forwarded to
+// stderr.
+func (r runner) invoke(args []string, object map[string]interface{}) ([]byte, error) {
+	responseDir, err := os.MkdirTemp("", "prototype-run-response")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(responseDir)
+	responsePath := filepath.Join(responseDir, "response.json")
+
+	request, err := json.Marshal(map[string]interface{}{
+		"object":        object,
+		"response_path": responsePath,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	cmd := exec.Command(r.binary, args...)
+	cmd.Dir = r.workDir
+	cmd.Stdin = bytes.NewReader(request)
+	cmd.Stdout = os.Stderr
+	cmd.Stderr = os.Stderr
+	runErr := cmd.Run()
+
+	response, err := os.ReadFile(responsePath)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+	return response, runErr
+}
+
+func (r runner) info(object map[string]interface{}) error {
+	fmt.Fprintln(r.stdout, "==> info")
+	payload, runErr := r.invoke(nil, object)
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(payload, &raw); err != nil {
+		if runErr != nil {
+			return runErr
+		}
+		return fmt.Errorf("invalid info response: %w", err)
+	}
+	if err := r.checkError(raw); err != nil {
+		return firstErr(runErr, err)
+	}
+	var response prototype.InfoResponse
+	if err := remarshal(raw, &response); err != nil {
+		return fmt.Errorf("invalid info response: %w", err)
+	}
+	fmt.Fprintln(r.stdout, indentJSON(response))
+	return runErr
+}
+
+func (r runner) message(message string, object map[string]interface{}) ([]prototype.MessageResponse, error) {
+	fmt.Fprintf(r.stdout, "==> %s\n", message)
+	payload, runErr := r.invoke([]string{message}, object)
+
+	var responses []prototype.MessageResponse
+	var failed error
+	decoder := json.NewDecoder(bytes.NewReader(payload))
+	for decoder.More() {
+		var raw map[string]json.RawMessage
+		if err := decoder.Decode(&raw); err != nil {
+			return nil, firstErr(runErr, fmt.Errorf("invalid response: %w", err))
+		}
+		if err := r.checkError(raw); err != nil {
+			failed = err
+			continue
+		}
+		var response prototype.MessageResponse
+		if err := remarshal(raw, &response); err != nil {
+			return nil, firstErr(runErr, fmt.Errorf("invalid response: %w", err))
+		}
+		r.printResponse(len(responses), response)
+		responses = append(responses, response)
+	}
+	if len(responses) == 0 && failed == nil {
+		fmt.Fprintln(r.stdout, "no responses")
+	}
+	if failed != nil || runErr != nil {
+		return nil, firstErr(runErr, failed)
+	}
+	return responses, nil
+}
+
+// checkError prints the error if the response is an ErrorResponse, and
+// returns an error describing it.
+func (r runner) checkError(raw map[string]json.RawMessage) error {
+	if _, ok := raw["error"]; !ok {
+		return nil
+	}
+	var response prototype.ErrorResponse
+	if err := remarshal(raw, &response); err != nil || response.Error == nil {
+		return fmt.Errorf("invalid error response: %s", raw["error"])
+	}
+	fmt.Fprintf(r.stdout, "error (%s): %s\n", response.Error.Code, response.Error.Message)
+	return fmt.Errorf("request failed with code %s", response.Error.Code)
+}
+
+// firstErr returns the first non-nil error. The error from running the
+// prototype is preferred, since it determines the exit code.
+func firstErr(errs ...error) error {
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r runner) printResponse(index int, response prototype.MessageResponse) {
+	fmt.Fprintf(r.stdout, "response %d:\n", index)
+	fmt.Fprintf(r.stdout, "  object: %s\n", strings.ReplaceAll(indentJSON(response.Object), "\n", "\n  "))
+	if len(response.Metadata) > 0 {
+		fmt.Fprintln(r.stdout, "  metadata:")
+		for _, field := range response.Metadata {
+			fmt.Fprintf(r.stdout, "    %s: %s\n", field.Name, field.Value)
+		}
+	}
+	artifacts := artifactsOf(response.Object)
+	if len(artifacts) > 0 {
+		fmt.Fprintln(r.stdout, "  artifacts:")
+		for _, path := range artifacts {
+			fmt.Fprintf(r.stdout, "    %s: %s\n", path, describeArtifact(filepath.Join(r.workDir, path)))
+		}
+	}
+}
+
+// chain returns the object to use for the message following message.
+func (r runner) chain(message string, object map[string]interface{}, responses []prototype.MessageResponse) (map[string]interface{}, error) {
+	index := r.pick
+	if index < 0 {
+		if len(responses) != 1 {
+			return nil, fmt.Errorf("cannot chain from %q: expected exactly one response, got %d (see -pick)", message, len(responses))
+		}
+		index = 0
+	}
+	if index >= len(responses) {
+		return nil, fmt.Errorf("cannot chain from %q: no response at index %d", message, index)
+	}
+	if !r.merge {
+		return responses[index].Object, nil
+	}
+	next := map[string]interface{}{}
+	for key, value := range object {
+		next[key] = value
+	}
+	for key, value := range responses[index].Object {
+		next[key] = value
+	}
+	return next, nil
+}
+
+// artifactsOf returns the paths of the artifacts in an object, which are
+// encoded as {"artifact": "path"} (optionally with a digest).
+func artifactsOf(object map[string]interface{}) []string {
+	var paths []string
+	var walk func(v interface{})
+	walk = func(v interface{}) {
+		switch v := v.(type) {
+		case map[string]interface{}:
+			if path, ok := v["artifact"].(string); ok {
+				paths = append(paths, path)
+				return
+			}
+			for _, elem := range v {
+				walk(elem)
+			}
+		case []interface{}:
+			for _, elem := range v {
+				walk(elem)
+			}
+		}
+	}
+	walk(object)
+	sort.Strings(paths)
+	return paths
+}
+
+// describeArtifact summarizes the file or directory at path.
+func describeArtifact(path string) string {
+	info, err := os.Stat(path)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return "missing"
+		}
+		return err.Error()
+	}
+	if !info.IsDir() {
+		return fmt.Sprintf("file, %d bytes", info.Size())
+	}
+	var files int
+	var size int64
+	filepath.WalkDir(path, func(_ string, d fs.DirEntry, err error) error {
+		if err != nil || !d.Type().IsRegular() {
+			return nil
+		}
+		if info, err := d.Info(); err == nil {
+			files++
+			size += info.Size()
+		}
+		return nil
+	})
+	return fmt.Sprintf("directory, %d file(s), %d bytes", files, size)
+}
+
+// copyInput copies the file or directory at src to dst.
+func copyInput(src, dst string) error {
+	return filepath.WalkDir(src, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dst, rel)
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return os.MkdirAll(target, info.Mode().Perm()|0700)
+		}
+		if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+			return err
+		}
+		contents, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		return os.WriteFile(target, contents, info.Mode().Perm())
+	})
+}
+
+func remarshal(src, dst interface{}) error {
+	payload, err := json.Marshal(src)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(payload, dst)
+}
+
+func indentJSON(v interface{}) string {
+	payload, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	return string(payload)
+}
@@ -0,0 +1,205 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	prototype "github.com/aoldershaw/prototype-sdk-go"
+	"github.com/aoldershaw/prototype-sdk-go/internal/prototypebin"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadObject(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, contents string) string {
+		path := filepath.Join(dir, name)
+		require.NoError(t, os.WriteFile(path, []byte(contents), 0644))
+		return path
+	}
+
+	for _, tt := range []struct {
+		desc     string
+		path     string
+		expected map[string]interface{}
+		err      string
+	}{
+		{
+			desc:     "no file",
+			path:     "",
+			expected: map[string]interface{}{},
+		},
+		{
+			desc: "yaml",
+			path: write("object.yml", "uri: https://example.com\ndepth: 1\ntags: [a, b]\nnested:\n  enabled: true\n"),
+			expected: map[string]interface{}{
+				"uri":    "https://example.com",
+				"depth":  float64(1),
+				"tags":   []interface{}{"a", "b"},
+				"nested": map[string]interface{}{"enabled": true},
+			},
+		},
+		{
+			desc:     "json",
+			path:     write("object.json", `{"context": {"artifact": "src"}, "depth": 1.5}`),
+			expected: map[string]interface{}{"context": map[string]interface{}{"artifact": "src"}, "depth": 1.5},
+		},
+		{
+			desc:     "empty",
+			path:     write("empty.yml", ""),
+			expected: map[string]interface{}{},
+		},
+		{
+			desc: "not a mapping",
+			path: write("list.yml", "- a\n- b\n"),
+			err:  "object must be a mapping",
+		},
+		{
+			desc: "missing",
+			path: filepath.Join(dir, "missing.yml"),
+			err:  "no such file or directory",
+		},
+	} {
+		t.Run(tt.desc, func(t *testing.T) {
+			object, err := readObject(tt.path)
+			if tt.err != "" {
+				require.Error(t, err)
+				require.Contains(t, err.Error(), tt.err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tt.expected, object)
+		})
+	}
+}
+
+func TestChain(t *testing.T) {
+	object := map[string]interface{}{"uri": "https://example.com", "branch": "main"}
+	responses := []prototype.MessageResponse{
+		{Object: map[string]interface{}{"ref": "abc"}},
+		{Object: map[string]interface{}{"ref": "def", "branch": "dev"}},
+	}
+
+	for _, tt := range []struct {
+		desc      string
+		runner    runner
+		responses []prototype.MessageResponse
+		expected  map[string]interface{}
+		err       string
+	}{
+		{
+			desc:      "single response",
+			runner:    runner{pick: -1},
+			responses: responses[:1],
+			expected:  map[string]interface{}{"ref": "abc"},
+		},
+		{
+			desc:      "multiple responses",
+			runner:    runner{pick: -1},
+			responses: responses,
+			err:       "expected exactly one response, got 2 (see -pick)",
+		},
+		{
+			desc:      "no responses",
+			runner:    runner{pick: -1},
+			responses: nil,
+			err:       "expected exactly one response, got 0 (see -pick)",
+		},
+		{
+			desc:      "pick",
+			runner:    runner{pick: 1},
+			responses: responses,
+			expected:  map[string]interface{}{"ref": "def", "branch": "dev"},
+		},
+		{
+			desc:      "pick out of range",
+			runner:    runner{pick: 2},
+			responses: responses,
+			err:       "no response at index 2",
+		},
+		{
+			desc:      "merge",
+			runner:    runner{pick: -1, merge: true},
+			responses: responses[:1],
+			expected:  map[string]interface{}{"uri": "https://example.com", "branch": "main", "ref": "abc"},
+		},
+		{
+			desc:      "pick and merge",
+			runner:    runner{pick: 1, merge: true},
+			responses: responses,
+			expected:  map[string]interface{}{"uri": "https://example.com", "branch": "dev", "ref": "def"},
+		},
+	} {
+		t.Run(tt.desc, func(t *testing.T) {
+			next, err := tt.runner.chain("list", object, tt.responses)
+			if tt.err != "" {
+				require.EqualError(t, err, `cannot chain from "list": `+tt.err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tt.expected, next)
+		})
+	}
+	require.Equal(t, map[string]interface{}{"uri": "https://example.com", "branch": "main"}, object, "object should not be modified")
+}
+
+func TestArtifactsOf(t *testing.T) {
+	require.Empty(t, artifactsOf(map[string]interface{}{"ref": "abc"}))
+	require.Equal(t, []string{"a", "b", "c", "d"}, artifactsOf(map[string]interface{}{
+		"image":  map[string]interface{}{"artifact": "d", "digest": "sha256:abc"},
+		"layers": []interface{}{map[string]interface{}{"artifact": "b"}, "not an artifact"},
+		"nested": map[string]interface{}{
+			"inputs": map[string]interface{}{"x": map[string]interface{}{"artifact": "a"}},
+			"cache":  map[string]interface{}{"artifact": "c"},
+		},
+		"count": float64(1),
+	}))
+}
+
+func TestCopyInput(t *testing.T) {
+	src := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(src, "sub", "empty"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(src, "Dockerfile"), []byte("FROM scratch"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(src, "sub", "run.sh"), []byte("#!/bin/sh"), 0755))
+
+	dst := filepath.Join(t.TempDir(), "inputs", "context")
+	require.NoError(t, copyInput(src, dst))
+	contents, err := os.ReadFile(filepath.Join(dst, "Dockerfile"))
+	require.NoError(t, err)
+	require.Equal(t, "FROM scratch", string(contents))
+	require.True(t, prototypebin.IsExecutable(filepath.Join(dst, "sub", "run.sh")))
+	require.DirExists(t, filepath.Join(dst, "sub", "empty"))
+
+	// a single file
+	file := filepath.Join(t.TempDir(), "nested", "Dockerfile")
+	require.NoError(t, copyInput(filepath.Join(src, "Dockerfile"), file))
+	contents, err = os.ReadFile(file)
+	require.NoError(t, err)
+	require.Equal(t, "FROM scratch", string(contents))
+
+	require.Error(t, copyInput(filepath.Join(src, "missing"), filepath.Join(t.TempDir(), "missing")))
+}
+
+func TestRunOCIImage(t *testing.T) {
+	binary, cleanup, err := prototypebin.Build(filepath.Join("..", "..", "examples", "oci-image"))
+	require.NoError(t, err)
+	defer cleanup()
+
+	src := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(src, "Dockerfile"), []byte("FROM scratch"), 0644))
+	objectPath := filepath.Join(t.TempDir(), "object.yml")
+	require.NoError(t, os.WriteFile(objectPath, []byte("context: {artifact: context}\n"), 0644))
+
+	workDir := t.TempDir()
+	err = run(binary, []string{"build"}, objectPath, inputs{"context": src}, workDir, -1, false)
+	require.NoError(t, err)
+	require.FileExists(t, filepath.Join(workDir, "context", "Dockerfile"))
+	require.DirExists(t, filepath.Join(workDir, "image"))
+
+	// the exit code of the prototype is propagated
+	err = run(binary, []string{"build"}, objectPath, inputs{}, t.TempDir(), -1, false)
+	var exitErr *exec.ExitError
+	require.ErrorAs(t, err, &exitErr)
+	require.Equal(t, prototype.ErrorCodeNoMatch.ExitCode(), exitErr.ExitCode())
+}
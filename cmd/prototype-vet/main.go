@@ -0,0 +1,61 @@
+// Command prototype-vet reports issues with the definitions of prototypes,
+// such as messages for which a payload can satisfy multiple objects (see
+// Prototype.Validate).
+//
+// Usage:
+//
+//	prototype-vet [package | binary]...
+//
+// Each argument is either a main package of a prototype (which is built with
+// `go build`) or a built prototype binary. The prototype must call Execute (or
+// Main). If no arguments are given, the package in the current directory is
+// checked.
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+
+	prototype "github.com/aoldershaw/prototype-sdk-go"
+	"github.com/aoldershaw/prototype-sdk-go/internal/prototypebin"
+)
+
+func main() {
+	targets := os.Args[1:]
+	if len(targets) == 0 {
+		targets = []string{"."}
+	}
+
+	exitCode := 0
+	for _, target := range targets {
+		if err := vet(target); err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %s\n", target, err)
+			exitCode = 1
+		}
+	}
+	os.Exit(exitCode)
+}
+
+func vet(target string) error {
+	binary, cleanup, err := prototypebin.Build(target)
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+
+	output, err := exec.Command(binary, "--validate").Output()
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) && exitErr.ExitCode() == prototype.ErrorCodeInvalidDefinition.ExitCode() {
+		fmt.Printf("%s:\n%s", target, output)
+		return errors.New("prototype definition has issues")
+	}
+	if err != nil {
+		if exitErr != nil {
+			return fmt.Errorf("%w\n%s", err, exitErr.Stderr)
+		}
+		return err
+	}
+	return nil
+}
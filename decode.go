@@ -4,108 +4,204 @@ import (
 	"encoding/json"
 	"fmt"
 	"reflect"
+	"sort"
+	"strings"
 
 	"github.com/mitchellh/reflectwalk"
 )
 
 type requiredFieldNotSetError struct {
-	name string
+	// path is the JSON path of the field.
+	path string
 }
 
 func (e requiredFieldNotSetError) Error() string {
-	return fmt.Sprintf("prototype: required field %q is unset", e.name)
+	return fmt.Sprintf("prototype: required field %q is unset", e.path)
 }
 
-func decodePossibleInvocations(object map[string]interface{}, objects []objectWrapper, messageName string) ([]invokableMessage, error) {
+// decodePossibleInvocations returns every message that could be invoked with
+// the given object. It also returns a Rejection for every candidate that was
+// skipped. Input artifacts are resolved against dir.
+func decodePossibleInvocations(dir string, object map[string]interface{}, objects []objectWrapper, messageName string) ([]invokableMessage, []Rejection, error) {
 	fullObjectJSON, payload, err := rawJSONObject(object)
 	if err != nil {
-		return nil, fmt.Errorf("re-marshal object: %w", err)
+		return nil, nil, fmt.Errorf("re-marshal object: %w", err)
 	}
 
 	var invokableMessages []invokableMessage
+	var rejections []Rejection
 	for _, wrapper := range objects {
 		rt := reflect.TypeOf(wrapper.object)
+		if messageName != "" && !wrapper.supports(messageName) {
+			rejections = append(rejections, newRejection(rt, "", unsupportedMessageError{msg: messageName, object: wrapper.object}))
+			continue
+		}
 		object := reflect.New(rt).Interface()
-		err := decodeSingle(payload, object)
+		err := decodeSingle(dir, payload, object)
 		if err != nil {
 			// skip over when fail to decode object
+			rejections = append(rejections, newRejection(rt, "", err))
 			continue
 		}
-		subObjectJSON, _, err := rawJSONObject(object)
-		if err != nil {
-			return nil, fmt.Errorf("invalid sub-object: %w", err)
-		}
-		jsonWithoutObject := jsonDiff(fullObjectJSON, subObjectJSON)
+		objectKeys := fieldKeys(rt)
+		jsonWithoutObject := jsonDiff(fullObjectJSON, objectKeys)
 		payloadWithoutObject, err := json.Marshal(jsonWithoutObject)
 		if err != nil {
-			return nil, fmt.Errorf("re-marshal sub-object: %w", err)
+			return nil, nil, fmt.Errorf("re-marshal sub-object: %w", err)
 		}
 		for _, msg := range wrapper.messages {
 			if messageName != "" && msg.name != messageName {
 				// we are invoking a specific message, and it doesn't match the current message, so skip
 				continue
 			}
-			request, err := decodeRequest(payloadWithoutObject, msg)
+			request, err := decodeRequest(dir, payloadWithoutObject, msg)
 			if err != nil {
 				// skip over when fail to decode request
+				rejections = append(rejections, newRejection(rt, msg.name, err))
 				continue
 			}
-			requestJSON, _, err := rawJSONObject(request)
-			if err != nil {
-				return nil, fmt.Errorf("invalid request object: %w", err)
-			}
-			leftoverJSON := jsonDiff(jsonWithoutObject, requestJSON)
+			requestKeys := fieldKeys(msg.requestType)
+			leftoverJSON := jsonDiff(jsonWithoutObject, requestKeys)
 			if !isJSONObjectEmpty(leftoverJSON) {
 				// skip over when there are unused entries in the JSON
 				// TODO: is this what we want for the info endpoint? when used
 				// with the run step, it's fine, since it'll have the request
 				// as well - but not sure how else concourse will use it
+				rejections = append(rejections, newRejection(rt, msg.name, unusedKeysError{keys: nonEmptyKeys(leftoverJSON)}))
 				continue
 			}
 			invokableMessages = append(invokableMessages, invokableMessage{
-				msg:     msg,
-				object:  dereference(object).(Object),
-				request: request,
+				msg:          msg,
+				object:       dereference(object).(Object),
+				request:      request,
+				requiredKeys: countRequired(objectKeys, requestKeys),
+				priority:     wrapper.priority,
+				middleware:   wrapper.middleware,
 			})
 		}
 	}
-	return invokableMessages, nil
+	return invokableMessages, rejections, nil
 }
 
-func decodeSingle(payload []byte, dst interface{}) error {
+func decodeSingle(dir string, payload []byte, dst interface{}) error {
 	if err := json.Unmarshal(payload, dst); err != nil {
 		return err
 	}
+	if err := applyDefaults(dst); err != nil {
+		return err
+	}
 
-	return reflectwalk.Walk(dst, requiredTagWalker{})
+	return reflectwalk.Walk(dst, &validationWalker{dir: dir})
 }
 
-func decodeRequest(payload []byte, message message) (interface{}, error) {
+func decodeRequest(dir string, payload []byte, message message) (interface{}, error) {
 	if message.requestType == nil {
 		// no request type for this message
 		return nil, nil
 	}
 	req := reflect.New(message.requestType).Interface()
-	err := decodeSingle(payload, req)
+	err := decodeSingle(dir, payload, req)
 	if err != nil {
 		return nil, err
 	}
 	return dereference(req), nil
 }
 
-type requiredTagWalker struct{}
+// validationWalker checks the value of each struct field against its
+// `prototype` tag (see fieldTag), and checks that input artifacts exist within
+// dir.
+type validationWalker struct {
+	jsonPath
+	dir string
+}
+
+func (*validationWalker) Struct(_ reflect.Value) error { return nil }
+func (w *validationWalker) StructField(field reflect.StructField, rv reflect.Value) error {
+	w.pushField(field)
+	tag, err := parseFieldTag(field)
+	if err != nil {
+		return err
+	}
+	if tag.required && rv.IsZero() {
+		return requiredFieldNotSetError{path: w.String()}
+	}
+	if reason, ok := tag.validate(rv); !ok {
+		return validationError{path: w.String(), reason: reason}
+	}
+	if isArtifactField(field.Type) {
+		return walkArtifacts(rv, func(a Artifact) error {
+			if reason, ok := a.checkInput(w.dir, tag); !ok {
+				return validationError{path: w.String(), reason: reason}
+			}
+			return nil
+		})
+	}
+	return nil
+}
+
+// jsonPath tracks the JSON path of the value currently being visited by
+// reflectwalk. Walkers should embed it and call pushField from StructField.
+type jsonPath struct {
+	segments []string
+}
 
-func (requiredTagWalker) Struct(_ reflect.Value) error { return nil }
-func (requiredTagWalker) StructField(field reflect.StructField, rv reflect.Value) error {
-	if field.Tag.Get("prototype") != "required" {
-		return nil
+func (p *jsonPath) pushField(field reflect.StructField) {
+	if field.Anonymous && strings.Split(field.Tag.Get("json"), ",")[0] == "" {
+		// the fields of embedded structs are promoted
+		p.segments = append(p.segments, "")
+		return
 	}
-	if rv.IsZero() {
-		return requiredFieldNotSetError{name: field.Name}
+	p.segments = append(p.segments, "."+jsonFieldName(field))
+}
+
+func (p *jsonPath) Slice(reflect.Value) error { return nil }
+func (p *jsonPath) Array(reflect.Value) error { return nil }
+func (p *jsonPath) Map(reflect.Value) error   { return nil }
+
+func (p *jsonPath) SliceElem(i int, _ reflect.Value) error {
+	p.segments = append(p.segments, fmt.Sprintf("[%d]", i))
+	return nil
+}
+
+func (p *jsonPath) ArrayElem(i int, _ reflect.Value) error {
+	return p.SliceElem(i, reflect.Value{})
+}
+
+func (p *jsonPath) MapElem(_, k, _ reflect.Value) error {
+	p.segments = append(p.segments, fmt.Sprintf(".%v", k.Interface()))
+	return nil
+}
+
+func (p *jsonPath) Enter(reflectwalk.Location) error { return nil }
+func (p *jsonPath) Exit(loc reflectwalk.Location) error {
+	switch loc {
+	case reflectwalk.StructField, reflectwalk.SliceElem, reflectwalk.ArrayElem, reflectwalk.MapValue:
+		p.segments = p.segments[:len(p.segments)-1]
 	}
 	return nil
 }
 
+func (p *jsonPath) String() string {
+	return strings.TrimPrefix(strings.Join(p.segments, ""), ".")
+}
+
+type unusedKeysError struct {
+	keys []string
+}
+
+func (e unusedKeysError) Error() string {
+	return fmt.Sprintf("prototype: unused keys %s", strings.Join(e.keys, ", "))
+}
+
+// jsonFieldName returns the name that encoding/json uses for the field.
+func jsonFieldName(field reflect.StructField) string {
+	name := strings.Split(field.Tag.Get("json"), ",")[0]
+	if name == "" {
+		return field.Name
+	}
+	return name
+}
+
 func rawJSONObject(obj interface{}) (map[string]json.RawMessage, []byte, error) {
 	objPayload, err := json.Marshal(obj)
 	if err != nil {
@@ -118,7 +214,43 @@ func rawJSONObject(obj interface{}) (map[string]json.RawMessage, []byte, error)
 	return raw, objPayload, nil
 }
 
-func jsonDiff(full, subtractKeys map[string]json.RawMessage) map[string]json.RawMessage {
+// fieldKeys returns the keys of the JSON fields of a struct type, and whether
+// each must be set (i.e. has the required or nonempty tag option). The keys
+// are derived from the type rather than by encoding a decoded value, since an
+// unset field may not be encodable (e.g. an Artifact).
+func fieldKeys(rt reflect.Type) map[string]bool {
+	keys := map[string]bool{}
+	if rt == nil {
+		return keys
+	}
+	for rt.Kind() == reflect.Ptr {
+		rt = rt.Elem()
+	}
+	if rt.Kind() != reflect.Struct {
+		return keys
+	}
+	for _, field := range jsonFields(rt) {
+		tag, _ := parseFieldTag(field.StructField)
+		keys[field.name] = tag.required || tag.nonempty
+	}
+	return keys
+}
+
+// countRequired returns the number of distinct keys that must be set in any of
+// the sets of keys (see fieldKeys).
+func countRequired(keySets ...map[string]bool) int {
+	required := map[string]bool{}
+	for _, keys := range keySets {
+		for key, isRequired := range keys {
+			if isRequired {
+				required[key] = true
+			}
+		}
+	}
+	return len(required)
+}
+
+func jsonDiff(full map[string]json.RawMessage, subtractKeys map[string]bool) map[string]json.RawMessage {
 	diff := map[string]json.RawMessage{}
 	for k, v := range full {
 		if _, ok := subtractKeys[k]; !ok {
@@ -128,6 +260,18 @@ func jsonDiff(full, subtractKeys map[string]json.RawMessage) map[string]json.Raw
 	return diff
 }
 
+// nonEmptyKeys returns the sorted keys of obj whose values are not zero.
+func nonEmptyKeys(obj map[string]json.RawMessage) []string {
+	var keys []string
+	for k, v := range obj {
+		if !isJSONObjectEmpty(map[string]json.RawMessage{k: v}) {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
 func isJSONObjectEmpty(obj map[string]json.RawMessage) bool {
 	for _, v := range obj {
 		var dst interface{}
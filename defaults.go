@@ -0,0 +1,110 @@
+package prototype
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"time"
+
+	"github.com/mitchellh/reflectwalk"
+)
+
+// Defaulter may be implemented (with a pointer receiver) by objects, requests
+// and any structs within them to set default values. Defaults is called after
+// the payload is decoded and `prototype:"default=..."` tags are applied, but
+// before the fields are validated. The Defaults of embedded and nested structs
+// are called before that of the struct containing them. Since methods are
+// promoted from embedded structs, Defaults should be idempotent.
+type Defaulter interface {
+	Defaults()
+}
+
+var (
+	defaulterType = reflect.TypeOf((*Defaulter)(nil)).Elem()
+	durationType  = reflect.TypeOf(time.Duration(0))
+)
+
+// applyDefaults sets the unset fields of each struct within dst to the value
+// of their `default` tag option, and then calls Defaults on each struct that
+// is a Defaulter. Since a Defaulter may depend on the defaults of its embedded
+// and nested structs, all tags are applied before any Defaulter is called, and
+// nested structs are defaulted before the structs that contain them.
+func applyDefaults(dst interface{}) error {
+	var walker defaultsWalker
+	if err := reflectwalk.Walk(dst, &walker); err != nil {
+		return err
+	}
+	for i := len(walker.defaulters) - 1; i >= 0; i-- {
+		walker.defaulters[i].Defaults()
+	}
+	return nil
+}
+
+// defaultsWalker sets the unset fields of each struct to the value of their
+// `default` tag option, and collects the structs that are Defaulters in the
+// order they are visited (i.e. each struct precedes the structs within it).
+type defaultsWalker struct {
+	defaulters []Defaulter
+}
+
+func (w *defaultsWalker) Struct(rv reflect.Value) error {
+	if !rv.CanAddr() {
+		return nil
+	}
+	for i := 0; i < rv.NumField(); i++ {
+		field := rv.Type().Field(i)
+		fv := rv.Field(i)
+		if !fv.CanSet() || !fv.IsZero() {
+			continue
+		}
+		tag, err := parseFieldTag(field)
+		if err != nil {
+			return err
+		}
+		if tag.defaultValue == nil {
+			continue
+		}
+		value, err := parseDefault(field.Type, *tag.defaultValue)
+		if err != nil {
+			return fmt.Errorf("prototype: invalid default on field %s: %w", field.Name, err)
+		}
+		fv.Set(value)
+	}
+	if defaulter, ok := rv.Addr().Interface().(Defaulter); ok {
+		w.defaulters = append(w.defaulters, defaulter)
+	}
+	return nil
+}
+
+func (*defaultsWalker) StructField(reflect.StructField, reflect.Value) error { return nil }
+
+// parseDefault parses the value of a `default` tag option into a value of
+// type rt.
+func parseDefault(rt reflect.Type, value string) (reflect.Value, error) {
+	ptr := reflect.New(rt)
+	switch {
+	case rt == durationType:
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return reflect.Value{}, err
+		}
+		ptr.Elem().SetInt(int64(d))
+	case rt.Kind() == reflect.String:
+		ptr.Elem().SetString(value)
+	default:
+		if err := json.Unmarshal([]byte(value), ptr.Interface()); err != nil {
+			return reflect.Value{}, err
+		}
+	}
+	return ptr.Elem(), nil
+}
+
+// defaultInstance returns a value of the struct type rt with only its
+// defaults set.
+func defaultInstance(rt reflect.Type) reflect.Value {
+	ptr := reflect.New(rt)
+	if err := applyDefaults(ptr.Interface()); err != nil {
+		return reflect.New(rt).Elem()
+	}
+	return ptr.Elem()
+}
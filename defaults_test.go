@@ -0,0 +1,113 @@
+package prototype_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/aoldershaw/prototype-sdk-go"
+	"github.com/stretchr/testify/require"
+)
+
+type DefaultedObject struct {
+	Dockerfile string        `json:"dockerfile,omitempty" prototype:"default=Dockerfile"`
+	Timeout    time.Duration `json:"timeout,omitempty" prototype:"default=1m"`
+	Retries    int           `json:"retries,omitempty" prototype:"default=3,max=5"`
+	Args       []string      `json:"args,omitempty" prototype:"default=[\"a\",\"b\"]"`
+	Target     string        `json:"target,omitempty" prototype:"required"`
+}
+
+func (o *DefaultedObject) Defaults() {
+	if o.Target == "" {
+		o.Target = "final"
+	}
+}
+
+func TestDefaults(t *testing.T) {
+	var received DefaultedObject
+	proto := prototype.New(
+		prototype.WithObject(DefaultedObject{},
+			prototype.WithMessage("msg", func(object DefaultedObject) []prototype.MessageResponse {
+				received = object
+				return nil
+			}),
+		))
+
+	_, err := proto.Run("msg", prototype.MessageRequest{Object: map[string]interface{}{
+		"retries": 1,
+	}})
+	require.NoError(t, err)
+	require.Equal(t, DefaultedObject{
+		Dockerfile: "Dockerfile",
+		Timeout:    time.Minute,
+		Retries:    1,
+		Args:       []string{"a", "b"},
+		Target:     "final",
+	}, received)
+}
+
+func TestDefaultsSchema(t *testing.T) {
+	properties := prototype.SchemaOf(DefaultedObject{}).Properties
+	require.Equal(t, "Dockerfile", properties["dockerfile"].Default)
+	require.Equal(t, time.Minute, properties["timeout"].Default)
+	require.Equal(t, 3, properties["retries"].Default)
+	require.Equal(t, []string{"a", "b"}, properties["args"].Default)
+	require.Equal(t, "final", properties["target"].Default)
+}
+
+func TestDefaultsInvalidTag(t *testing.T) {
+	type BadDefault struct {
+		Count int `json:"count" prototype:"default=lots"`
+	}
+	require.Panics(t, func() {
+		prototype.New(prototype.WithObject(BadDefault{}))
+	})
+}
+
+type InnerDefaults struct {
+	Registry string `json:"registry,omitempty" prototype:"default=docker.io"`
+}
+
+type OuterDefaults struct {
+	InnerDefaults
+	Cache struct {
+		Dir string `json:"dir,omitempty" prototype:"default=/cache"`
+	} `json:"cache"`
+	Image    string `json:"image,omitempty"`
+	CacheDir string `json:"cache_dir,omitempty"`
+}
+
+func (o *OuterDefaults) Defaults() {
+	if o.Image == "" {
+		o.Image = o.Registry + "/library/busybox"
+	}
+	if o.CacheDir == "" {
+		o.CacheDir = o.Cache.Dir
+	}
+}
+
+func TestDefaultsNested(t *testing.T) {
+	var received OuterDefaults
+	proto := prototype.New(
+		prototype.WithObject(OuterDefaults{},
+			prototype.WithMessage("msg", func(object OuterDefaults) []prototype.MessageResponse {
+				received = object
+				return nil
+			}),
+		))
+
+	// the tag defaults of embedded and nested structs are applied before
+	// Defaults is called
+	_, err := proto.Run("msg", prototype.MessageRequest{Object: map[string]interface{}{}})
+	require.NoError(t, err)
+	require.Equal(t, "docker.io", received.Registry)
+	require.Equal(t, "docker.io/library/busybox", received.Image)
+	require.Equal(t, "/cache", received.CacheDir)
+
+	_, err = proto.Run("msg", prototype.MessageRequest{Object: map[string]interface{}{
+		"registry": "ghcr.io",
+		"cache":    map[string]interface{}{"dir": "/tmp/cache"},
+	}})
+	require.NoError(t, err)
+	require.Equal(t, "ghcr.io/library/busybox", received.Image)
+	require.Equal(t, "/tmp/cache", received.CacheDir)
+}
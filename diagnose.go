@@ -0,0 +1,146 @@
+package prototype
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+)
+
+// Rejection describes why a registered object (or one of its messages) did
+// not satisfy a payload.
+type Rejection struct {
+	// The name of the object type.
+	ObjectType string
+
+	// The name of the message that was rejected. Empty if the object itself
+	// could not be decoded from the payload, in which case none of its
+	// messages were considered.
+	Message string
+
+	// The JSON path of the field that caused the rejection, if known.
+	Field string
+
+	// The keys in the payload that were used by neither the object nor the
+	// message's request.
+	UnusedKeys []string
+
+	// The underlying cause of the rejection.
+	Reason error
+}
+
+func newRejection(objectType reflect.Type, message string, reason error) Rejection {
+	r := Rejection{
+		ObjectType: objectType.Name(),
+		Message:    message,
+		Field:      fieldPath(reason),
+		Reason:     reason,
+	}
+	var unusedErr unusedKeysError
+	if errors.As(reason, &unusedErr) {
+		r.UnusedKeys = unusedErr.keys
+	}
+	return r
+}
+
+func (r Rejection) String() string {
+	if r.Message == "" {
+		return fmt.Sprintf("%s: %s", r.ObjectType, r.Reason)
+	}
+	return fmt.Sprintf("%s (message %q): %s", r.ObjectType, r.Message, r.Reason)
+}
+
+// unsupported returns whether the candidate was rejected only because it does
+// not support the requested message.
+func (r Rejection) unsupported() bool {
+	var unsupportedErr unsupportedMessageError
+	return errors.As(r.Reason, &unsupportedErr)
+}
+
+// NoMatchError is returned by Run when no registered object satisfies the
+// payload. It reports why each candidate was rejected.
+type NoMatchError struct {
+	// The message that was requested.
+	Message string
+
+	// A Rejection for each candidate that was considered.
+	Rejections []Rejection
+}
+
+func (e NoMatchError) Error() string {
+	if r, ok := e.culprit(); ok {
+		return fmt.Sprintf("no object satisfied payload: %s", r)
+	}
+	return "no object satisfied payload"
+}
+
+// Unwrap returns the reason for the rejection if there was a single candidate
+// that supports the message.
+func (e NoMatchError) Unwrap() error {
+	if r, ok := e.culprit(); ok {
+		return r.Reason
+	}
+	return nil
+}
+
+// culprit returns the Rejection responsible for the failure if exactly one
+// candidate supports the requested message.
+func (e NoMatchError) culprit() (Rejection, bool) {
+	var candidates []Rejection
+	for _, r := range e.Rejections {
+		if !r.unsupported() {
+			candidates = append(candidates, r)
+		}
+	}
+	if len(candidates) != 1 {
+		return Rejection{}, false
+	}
+	return candidates[0], true
+}
+
+// Diagnose explains why each registered object and message does or does not
+// satisfy the object. If message is empty, all messages are considered (as
+// with Info).
+func (p Prototype) Diagnose(message string, object map[string]interface{}) ([]Rejection, error) {
+	return p.diagnose("", message, object)
+}
+
+// diagnose is Diagnose with input artifacts resolved against dir.
+func (p Prototype) diagnose(dir, message string, object map[string]interface{}) ([]Rejection, error) {
+	_, rejections, err := decodePossibleInvocations(dir, object, p.objects, message)
+	return rejections, err
+}
+
+// writeDiagnostics writes a human readable report of the rejections to w.
+func writeDiagnostics(w io.Writer, message string, rejections []Rejection) {
+	if message == "" {
+		fmt.Fprintln(w, "prototype: info diagnostics:")
+	} else {
+		fmt.Fprintf(w, "prototype: diagnostics for message %q:\n", message)
+	}
+	if len(rejections) == 0 {
+		fmt.Fprintln(w, "  no candidates were rejected")
+	}
+	for _, r := range rejections {
+		fmt.Fprintf(w, "  %s\n", r)
+	}
+}
+
+// fieldPath returns the JSON path of the field responsible for err, if known.
+func fieldPath(err error) string {
+	var requiredErr requiredFieldNotSetError
+	if errors.As(err, &requiredErr) {
+		return requiredErr.path
+	}
+	var validationErr validationError
+	if errors.As(err, &validationErr) {
+		return validationErr.path
+	}
+	var typeErr *json.UnmarshalTypeError
+	if errors.As(err, &typeErr) {
+		return strings.TrimPrefix(typeErr.Field, ".")
+	}
+	return ""
+}
@@ -0,0 +1,285 @@
+package prototype
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+)
+
+// WithArtifactDigests makes Execute (along with Serve and RunBatch) compute a
+// digest of the contents of each Artifact in the responses. The digest is
+// included in the encoded artifact, e.g.
+//
+//	{"artifact": "image", "digest": "sha256:..."}
+//
+// and is added to the response's Metadata. When an Artifact in the object or
+// request of a payload is encoded with a digest, Run verifies the digest
+// against the contents of the artifact before invoking the message (see
+// ArtifactDigestError).
+func WithArtifactDigests() Option {
+	return func(p *Prototype) {
+		p.artifactDigests = true
+	}
+}
+
+// ArtifactDigestError is returned by Run when the payload contains an artifact
+// whose contents do not match its digest. The digest of the contents is not
+// included, since the error is reported to the caller.
+type ArtifactDigestError struct {
+	// The path of the artifact.
+	Path string
+
+	// The digest the artifact was encoded with.
+	Expected string
+}
+
+func (e ArtifactDigestError) Error() string {
+	return fmt.Sprintf("artifact %q does not match its digest %s", e.Path, e.Expected)
+}
+
+// Digest computes the digest of the contents of the artifact, which is the
+// sha256 of a canonical tar archive of the file or directory. Only the names,
+// types, permissions and contents of the files are included in the archive.
+// The artifact is resolved against the working directory of ctx (see
+// WorkingDir), and an ArtifactPathError is returned if it is not within it.
+func (a Artifact) Digest(ctx context.Context) (string, error) {
+	return a.digest(workingDir(ctx))
+}
+
+// digest computes the digest of the artifact within dir.
+func (a Artifact) digest(dir string) (string, error) {
+	if err := a.check(dir); err != nil {
+		return "", err
+	}
+	root := a.in(dir)
+	hash := sha256.New()
+	tw := tar.NewWriter(hash)
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		header := &tar.Header{
+			Name:    filepath.ToSlash(rel),
+			Mode:    int64(info.Mode().Perm()),
+			ModTime: time.Unix(0, 0),
+			Format:  tar.FormatPAX,
+		}
+		switch {
+		case info.Mode().IsRegular():
+			header.Typeflag = tar.TypeReg
+			header.Size = info.Size()
+		case info.IsDir():
+			header.Typeflag = tar.TypeDir
+		case info.Mode()&fs.ModeSymlink != 0:
+			header.Typeflag = tar.TypeSymlink
+			if header.Linkname, err = os.Readlink(path); err != nil {
+				return err
+			}
+		default:
+			// devices, sockets, etc. have no meaningful contents
+			return nil
+		}
+		if err := tw.WriteHeader(header); err != nil {
+			return err
+		}
+		if header.Typeflag != tar.TypeReg {
+			return nil
+		}
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		_, err = io.Copy(tw, f)
+		return err
+	})
+	if err != nil {
+		return "", fmt.Errorf("digest artifact %q: %w", a, err)
+	}
+	if err := tw.Close(); err != nil {
+		return "", fmt.Errorf("digest artifact %q: %w", a, err)
+	}
+	return "sha256:" + hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// verifyArtifactDigests verifies the digest of each Artifact in the object and
+// request of the invocation that was encoded with one in the payload. Since
+// digesting an artifact is expensive, this is done once the object has been
+// resolved, rather than while decoding each candidate, and each artifact is
+// only digested once. Artifacts are resolved against dir.
+func verifyArtifactDigests(dir string, invocation invokableMessage, object map[string]interface{}) error {
+	payload, err := json.Marshal(object)
+	if err != nil {
+		return err
+	}
+	digests := map[Artifact]string{}
+	verify := func(artifact Artifact, digest string) error {
+		actual, ok := digests[artifact]
+		if !ok {
+			var err error
+			if actual, err = artifact.digest(dir); err != nil {
+				return err
+			}
+			digests[artifact] = actual
+		}
+		if actual != digest {
+			return ArtifactDigestError{Path: string(artifact), Expected: digest}
+		}
+		return nil
+	}
+	if err := walkArtifactDigests(reflect.ValueOf(invocation.object), payload, verify); err != nil {
+		return err
+	}
+	if invocation.request == nil {
+		return nil
+	}
+	return walkArtifactDigests(reflect.ValueOf(invocation.request), payload, verify)
+}
+
+// walkArtifactDigests calls fn with each Artifact in rv that has a digest in
+// payload, the JSON that rv was decoded from. Only values that were decoded
+// into an Artifact are considered, so objects in free-form fields that look
+// like artifacts are ignored.
+func walkArtifactDigests(rv reflect.Value, payload json.RawMessage, fn func(Artifact, string) error) error {
+	if len(payload) == 0 {
+		return nil
+	}
+	switch rv.Kind() {
+	case reflect.Interface, reflect.Ptr:
+		if rv.IsNil() {
+			return nil
+		}
+		return walkArtifactDigests(rv.Elem(), payload, fn)
+	case reflect.String:
+		if rv.Type() != artifactType {
+			return nil
+		}
+		var encoded struct {
+			Digest string `json:"digest"`
+		}
+		if err := json.Unmarshal(payload, &encoded); err != nil || encoded.Digest == "" {
+			return nil
+		}
+		return fn(Artifact(rv.String()), encoded.Digest)
+	case reflect.Struct:
+		var fields map[string]json.RawMessage
+		if err := json.Unmarshal(payload, &fields); err != nil {
+			return nil
+		}
+		for i := 0; i < rv.NumField(); i++ {
+			field := rv.Type().Field(i)
+			if !field.IsExported() {
+				continue
+			}
+			fieldPayload := payload
+			name := strings.Split(field.Tag.Get("json"), ",")[0]
+			if name == "-" {
+				continue
+			}
+			if !field.Anonymous || name != "" {
+				// the fields of embedded structs are promoted
+				fieldPayload = fields[jsonFieldName(field)]
+			}
+			if err := walkArtifactDigests(rv.Field(i), fieldPayload, fn); err != nil {
+				return err
+			}
+		}
+	case reflect.Map:
+		var elems map[string]json.RawMessage
+		if err := json.Unmarshal(payload, &elems); err != nil {
+			return nil
+		}
+		iter := rv.MapRange()
+		for iter.Next() {
+			if err := walkArtifactDigests(iter.Value(), elems[fmt.Sprint(iter.Key().Interface())], fn); err != nil {
+				return err
+			}
+		}
+	case reflect.Slice, reflect.Array:
+		var elems []json.RawMessage
+		if err := json.Unmarshal(payload, &elems); err != nil {
+			return nil
+		}
+		for i := 0; i < rv.Len() && i < len(elems); i++ {
+			if err := walkArtifactDigests(rv.Index(i), elems[i], fn); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// addArtifactDigests returns the response with a digest added to each of its
+// encoded artifacts, and a MetadataField for each digest. Since Artifact is a
+// string, the digests are added to the JSON representation of the object.
+// Artifacts are resolved against dir.
+func addArtifactDigests(dir string, response MessageResponse) (MessageResponse, error) {
+	payload, err := json.Marshal(response.Object)
+	if err != nil {
+		return MessageResponse{}, err
+	}
+	decoder := json.NewDecoder(bytes.NewReader(payload))
+	decoder.UseNumber()
+	var object map[string]interface{}
+	if err := decoder.Decode(&object); err != nil {
+		return MessageResponse{}, err
+	}
+
+	metadata := append([]MetadataField(nil), response.Metadata...)
+	var walk func(v interface{}) error
+	walk = func(v interface{}) error {
+		switch v := v.(type) {
+		case map[string]interface{}:
+			if path, ok := v["artifact"].(string); ok && len(v) == 1 {
+				digest, err := Artifact(path).digest(dir)
+				if err != nil {
+					return err
+				}
+				v["digest"] = digest
+				metadata = append(metadata, MetadataField{Name: path + " digest", Value: digest})
+				return nil
+			}
+			keys := make([]string, 0, len(v))
+			for key := range v {
+				keys = append(keys, key)
+			}
+			sort.Strings(keys)
+			for _, key := range keys {
+				if err := walk(v[key]); err != nil {
+					return err
+				}
+			}
+		case []interface{}:
+			for _, elem := range v {
+				if err := walk(elem); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}
+	if err := walk(object); err != nil {
+		return MessageResponse{}, err
+	}
+	return MessageResponse{Object: object, Metadata: metadata}, nil
+}
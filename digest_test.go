@@ -0,0 +1,208 @@
+package prototype_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aoldershaw/prototype-sdk-go"
+	"github.com/stretchr/testify/require"
+)
+
+func TestArtifactDigest(t *testing.T) {
+	inTempDir(t)
+	for _, dir := range []string{"a", "b"} {
+		require.NoError(t, os.MkdirAll(filepath.Join(dir, "sub"), 0755))
+		require.NoError(t, os.WriteFile(filepath.Join(dir, "sub", "file"), []byte("contents"), 0644))
+	}
+	require.NoError(t, os.Chtimes(filepath.Join("b", "sub", "file"), time.Now(), time.Unix(1000, 0)))
+
+	digestA, err := prototype.Artifact("a").Digest(context.Background())
+	require.NoError(t, err)
+	require.Regexp(t, `^sha256:[0-9a-f]{64}$`, digestA)
+
+	digestB, err := prototype.Artifact("b").Digest(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, digestA, digestB, "digest should only depend on contents")
+
+	require.NoError(t, os.WriteFile(filepath.Join("b", "sub", "file"), []byte("changed"), 0644))
+	digestB, err = prototype.Artifact("b").Digest(context.Background())
+	require.NoError(t, err)
+	require.NotEqual(t, digestA, digestB)
+
+	var artifact prototype.Artifact
+	require.NoError(t, json.Unmarshal([]byte(`{"artifact": "a", "digest": "`+digestA+`"}`), &artifact))
+	require.Equal(t, prototype.Artifact("a"), artifact)
+
+	type Image struct {
+		Context prototype.Artifact `json:"context" prototype:"required"`
+	}
+	type OtherImage struct {
+		Context prototype.Artifact `json:"context" prototype:"required"`
+		Tag     string             `json:"tag"`
+	}
+	var invoked []prototype.Artifact
+	proto := prototype.New(
+		prototype.WithObject(Image{},
+			prototype.WithMessage("build", func(image Image) []prototype.MessageResponse {
+				invoked = append(invoked, image.Context)
+				return nil
+			}),
+		),
+		prototype.WithObject(OtherImage{}, prototype.WithPriority(-1),
+			prototype.WithMessage("build", noop),
+		),
+	)
+	withDigest := func(path, digest string) prototype.MessageRequest {
+		return prototype.MessageRequest{Object: map[string]interface{}{
+			"context": map[string]interface{}{"artifact": path, "digest": digest},
+		}}
+	}
+
+	_, err = proto.Run("build", withDigest("a", digestA))
+	require.NoError(t, err)
+	require.Equal(t, []prototype.Artifact{"a"}, invoked)
+
+	_, err = proto.Run("build", withDigest("b", digestA))
+	var digestErr prototype.ArtifactDigestError
+	require.ErrorAs(t, err, &digestErr)
+	require.Equal(t, prototype.ArtifactDigestError{Path: "b", Expected: digestA}, digestErr)
+	require.Equal(t, prototype.ErrorCodeInvalidRequest, prototype.AsError(err).Code)
+	require.NotContains(t, err.Error(), digestB, "the digest of the contents should not be reported")
+	require.Equal(t, []prototype.Artifact{"a"}, invoked, "handler should not be invoked")
+}
+
+func TestArtifactDigestTraversal(t *testing.T) {
+	dir := inTempDir(t)
+	require.NoError(t, os.WriteFile(filepath.Join(filepath.Dir(dir), "secret"), []byte("contents"), 0644))
+	require.NoError(t, os.Symlink(filepath.Dir(dir), "outside-link"))
+
+	ctx := context.Background()
+	for _, path := range []string{"../secret", "outside-link/secret", "/etc/passwd"} {
+		_, err := prototype.Artifact(path).Digest(ctx)
+		var pathErr prototype.ArtifactPathError
+		require.ErrorAs(t, err, &pathErr, path)
+	}
+
+	type Image struct {
+		Context prototype.Artifact     `json:"context"`
+		Labels  map[string]interface{} `json:"labels"`
+	}
+	invoked := 0
+	proto := prototype.New(
+		prototype.WithObject(Image{},
+			prototype.WithMessage("build", func(Image) []prototype.MessageResponse {
+				invoked++
+				return nil
+			}),
+		),
+	)
+	outside := map[string]interface{}{"artifact": "../secret", "digest": "sha256:00"}
+
+	// artifacts that are not within the working directory are rejected before
+	// they are digested
+	for _, path := range []string{"../secret", "outside-link/secret"} {
+		_, err := proto.Run("build", prototype.MessageRequest{Object: map[string]interface{}{
+			"context": map[string]interface{}{"artifact": path, "digest": "sha256:00"},
+		}})
+		require.Equal(t, prototype.ErrorCodeNoMatch, prototype.AsError(err).Code, path)
+		var digestErr prototype.ArtifactDigestError
+		require.False(t, errors.As(err, &digestErr), path)
+	}
+	require.Zero(t, invoked)
+
+	// values that only look like artifacts are not digested
+	_, err := proto.Run("build", prototype.MessageRequest{Object: map[string]interface{}{
+		"labels": map[string]interface{}{"image": outside, "layers": []interface{}{outside}},
+	}})
+	require.NoError(t, err)
+	require.Equal(t, 1, invoked)
+}
+
+func TestArtifactDigestNested(t *testing.T) {
+	inTempDir(t)
+	require.NoError(t, os.Mkdir("layer", 0755))
+	digest, err := prototype.Artifact("layer").Digest(context.Background())
+	require.NoError(t, err)
+
+	type Layers struct {
+		Layers []prototype.Artifact `json:"layers"`
+	}
+	type Image struct {
+		Layers
+		Inputs map[string]*prototype.Artifact `json:"inputs"`
+	}
+	proto := prototype.New(
+		prototype.WithObject(Image{},
+			prototype.WithMessage("build", noop),
+		),
+	)
+	artifact := func(digest string) map[string]interface{} {
+		return map[string]interface{}{"artifact": "layer", "digest": digest}
+	}
+	for _, object := range []map[string]interface{}{
+		{"layers": []interface{}{artifact(digest), artifact("sha256:00")}},
+		{"inputs": map[string]interface{}{"a": artifact(digest), "b": artifact("sha256:00")}},
+	} {
+		_, err := proto.Run("build", prototype.MessageRequest{Object: object})
+		var digestErr prototype.ArtifactDigestError
+		require.ErrorAs(t, err, &digestErr)
+		require.Equal(t, prototype.ArtifactDigestError{Path: "layer", Expected: "sha256:00"}, digestErr)
+	}
+
+	_, err = proto.Run("build", prototype.MessageRequest{Object: map[string]interface{}{
+		"layers": []interface{}{artifact(digest)},
+		"inputs": map[string]interface{}{"a": artifact(digest)},
+	}})
+	require.NoError(t, err)
+}
+
+func TestWithArtifactDigests(t *testing.T) {
+	inTempDir(t)
+	require.NoError(t, os.Mkdir("image", 0755))
+	require.NoError(t, os.WriteFile(filepath.Join("image", "layer"), []byte("contents"), 0644))
+	digest, err := prototype.Artifact("image").Digest(context.Background())
+	require.NoError(t, err)
+
+	type Output struct {
+		Images []prototype.Artifact `json:"images"`
+		Count  int                  `json:"count"`
+	}
+	proto := prototype.New(
+		prototype.WithArtifactDigests(),
+		prototype.WithObject(SimpleObject{},
+			prototype.WithMessage("build", func(SimpleObject) []prototype.MessageResponse {
+				return []prototype.MessageResponse{{
+					Object: map[string]interface{}{
+						"output": Output{Images: []prototype.Artifact{"image"}, Count: 12345678901},
+					},
+					Metadata: []prototype.MetadataField{{Name: "existing", Value: "field"}},
+				}}
+			}),
+		))
+
+	var out bytes.Buffer
+	err = proto.RunBatch(context.Background(), strings.NewReader(`{"message": "build", "object": {"foo": "abc"}}`), &out)
+	require.NoError(t, err)
+	require.JSONEq(t, `{
+		"index": 0,
+		"responses": [{
+			"object": {
+				"output": {
+					"images": [{"artifact": "image", "digest": "`+digest+`"}],
+					"count": 12345678901
+				}
+			},
+			"metadata": [
+				{"name": "existing", "value": "field"},
+				{"name": "image digest", "value": "`+digest+`"}
+			]
+		}]
+	}`, out.String())
+}
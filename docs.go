@@ -0,0 +1,337 @@
+package prototype
+
+import (
+	"encoding/json"
+	"fmt"
+	htmltemplate "html/template"
+	"io"
+	"reflect"
+	"strings"
+	texttemplate "text/template"
+)
+
+// DocsFormat is the format of the documentation written by GenerateDocs.
+type DocsFormat string
+
+const (
+	// DocsMarkdown is a markdown document, e.g. for a README.
+	DocsMarkdown DocsFormat = "markdown"
+	// DocsHTML is a standalone HTML page.
+	DocsHTML DocsFormat = "html"
+)
+
+// GenerateDocs writes reference documentation for the prototype to w in the
+// given format. The documentation is derived from the registered objects and
+// their messages: each object has a section describing its fields (see
+// WithDescription and WithObject for the supported tag options) and a table
+// of its messages, and each message describes its request and includes an
+// example payload that satisfies the object and the request.
+func (p Prototype) GenerateDocs(w io.Writer, format DocsFormat) error {
+	docs := p.docs()
+	switch format {
+	case DocsMarkdown:
+		return markdownTemplate.Execute(w, docs)
+	case DocsHTML:
+		return htmlTemplate.Execute(w, docs)
+	default:
+		return fmt.Errorf("unsupported docs format %q", format)
+	}
+}
+
+type docsPrototype struct {
+	Icon    string
+	Objects []docsObject
+}
+
+type docsObject struct {
+	Name        string
+	Description string
+	Fields      []docsField
+	Messages    []docsMessage
+}
+
+type docsMessage struct {
+	Name              string
+	Description       string
+	Request           []docsField
+	ProducesArtifacts bool
+	SideEffects       bool
+	Example           string
+}
+
+type docsField struct {
+	Name        string
+	Type        string
+	Required    bool
+	Default     string
+	Constraints []string
+}
+
+func (p Prototype) docs() docsPrototype {
+	docs := docsPrototype{Icon: p.Icon}
+	for _, wrapper := range p.objects {
+		rt := reflect.TypeOf(wrapper.object)
+		object := docsObject{
+			Name:        rt.Name(),
+			Description: wrapper.description,
+			Fields:      docsFields(rt),
+		}
+		for _, msg := range wrapper.messages {
+			info := invokableMessage{msg: msg}.info()
+			message := docsMessage{
+				Name:              msg.name,
+				Description:       msg.description,
+				ProducesArtifacts: info.ProducesArtifacts,
+				SideEffects:       msg.sideEffects,
+			}
+			example := docsExample(rt)
+			if msg.requestType != nil {
+				message.Request = docsFields(msg.requestType)
+				for key, value := range docsExample(msg.requestType) {
+					example[key] = value
+				}
+			}
+			payload, _ := json.MarshalIndent(example, "", "  ")
+			message.Example = string(payload)
+			object.Messages = append(object.Messages, message)
+		}
+		docs.Objects = append(docs.Objects, object)
+	}
+	return docs
+}
+
+// docsExample returns an example payload with the required fields of a struct
+// type.
+func docsExample(rt reflect.Type) map[string]interface{} {
+	example, ok := newExampleBuilder().build(rt, reflect.StructField{}).(map[string]interface{})
+	if !ok {
+		return map[string]interface{}{}
+	}
+	return example
+}
+
+// docsFields describes the fields of a struct type, in declaration order.
+func docsFields(rt reflect.Type) []docsField {
+	for rt.Kind() == reflect.Ptr {
+		rt = rt.Elem()
+	}
+	if rt.Kind() != reflect.Struct {
+		return nil
+	}
+	schema := schemaForType(rt)
+	var fields []docsField
+	for _, field := range jsonFields(rt) {
+		fieldSchema := schema.Properties[field.name]
+		tag, _ := parseFieldTag(field.StructField)
+		doc := docsField{
+			Name:        field.name,
+			Type:        docsType(fieldSchema),
+			Required:    tag.required,
+			Constraints: docsConstraints(tag),
+		}
+		if fieldSchema.Default != nil {
+			value, _ := json.Marshal(fieldSchema.Default)
+			doc.Default = string(value)
+		}
+		fields = append(fields, doc)
+	}
+	return fields
+}
+
+// docsType returns a human readable name for the type described by a schema.
+func docsType(s *Schema) string {
+	switch {
+	case s.Type == "object" && s.Properties["artifact"] != nil:
+		return "artifact"
+	case s.Type == "array" && s.Items != nil:
+		return "array of " + docsType(s.Items)
+	case s.Type == "object" && s.AdditionalProperties != nil:
+		return "map of " + docsType(s.AdditionalProperties)
+	case s.Type == "string" && s.Format == "date-time":
+		return "timestamp"
+	case s.Type == "":
+		return "any"
+	}
+	return s.Type
+}
+
+// docsConstraints describes the validation options of a tag, other than
+// required and default.
+func docsConstraints(tag fieldTag) []string {
+	var constraints []string
+	add := func(format string, args ...interface{}) {
+		constraints = append(constraints, fmt.Sprintf(format, args...))
+	}
+	if tag.nonempty {
+		add("non-empty")
+	}
+	if tag.min != nil {
+		add("min %v", *tag.min)
+	}
+	if tag.max != nil {
+		add("max %v", *tag.max)
+	}
+	if tag.length != nil {
+		add("length %d", *tag.length)
+	}
+	if len(tag.oneof) > 0 {
+		add("one of %s", strings.Join(tag.oneof, ", "))
+	}
+	if tag.url {
+		add("URL")
+	}
+	if tag.semver {
+		add("semantic version")
+	}
+	if tag.duration {
+		add("duration")
+	}
+	if tag.pattern != nil {
+		add("matches %s", tag.pattern)
+	}
+	if tag.file {
+		add("file")
+	}
+	if tag.dir {
+		add("directory")
+	}
+	return constraints
+}
+
+var docsFuncs = map[string]interface{}{
+	"anchor": func(name string) string {
+		return strings.ToLower(name)
+	},
+	"join": strings.Join,
+	"cell": func(s string) string {
+		// pipes would end the cell of a markdown table
+		return strings.ReplaceAll(s, "|", `\|`)
+	},
+	"fieldsTable": func(title string, fields []docsField) interface{} {
+		return struct {
+			Title  string
+			Fields []docsField
+		}{title, fields}
+	},
+	"yesno": func(b bool) string {
+		if b {
+			return "yes"
+		}
+		return "no"
+	},
+}
+
+var markdownTemplate = texttemplate.Must(texttemplate.New("markdown").Funcs(docsFuncs).Parse(`
+{{- define "fields"}}
+| {{.Title}} | Type | Required | Default | Constraints |
+| --- | --- | --- | --- | --- |
+{{- range .Fields}}
+| ` + "`{{.Name}}`" + ` | {{.Type}} | {{yesno .Required}} | {{if .Default}}` + "`{{cell .Default}}`" + `{{end}} | {{cell (join .Constraints ", ")}} |
+{{- end}}
+{{- end -}}
+# Reference
+{{- if .Icon}}
+
+Icon: ` + "`{{.Icon}}`" + `
+{{- end}}
+
+Objects:
+{{range .Objects}}
+- [{{.Name}}](#{{anchor .Name}})
+{{- end}}
+{{range .Objects}}
+## {{.Name}}
+{{- if .Description}}
+
+{{.Description}}
+{{- end}}
+{{- if .Fields}}
+{{template "fields" (fieldsTable "Field" .Fields)}}
+{{- end}}
+{{- if .Messages}}
+
+| Message | Description | Produces artifacts | Side effects |
+| --- | --- | --- | --- |
+{{- range .Messages}}
+| ` + "`{{.Name}}`" + ` | {{cell .Description}} | {{yesno .ProducesArtifacts}} | {{yesno .SideEffects}} |
+{{- end}}
+{{- range .Messages}}
+
+### {{.Name}}
+{{- if .Description}}
+
+{{.Description}}
+{{- end}}
+{{- if .Request}}
+{{template "fields" (fieldsTable "Request field" .Request)}}
+{{- end}}
+
+Example payload:
+
+` + "```json" + `
+{{.Example}}
+` + "```" + `
+{{- end}}
+{{- else}}
+
+This object supports no messages.
+{{- end}}
+{{end}}`))
+
+var htmlTemplate = htmltemplate.Must(htmltemplate.New("html").Funcs(docsFuncs).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Reference</title>
+</head>
+<body>
+<h1>Reference</h1>
+{{- if .Icon}}
+<p>Icon: <code>{{.Icon}}</code></p>
+{{- end}}
+<ul>
+{{- range .Objects}}
+<li><a href="#{{anchor .Name}}">{{.Name}}</a></li>
+{{- end}}
+</ul>
+{{- define "fields"}}
+<table>
+<tr><th>{{.Title}}</th><th>Type</th><th>Required</th><th>Default</th><th>Constraints</th></tr>
+{{- range .Fields}}
+<tr><td><code>{{.Name}}</code></td><td>{{.Type}}</td><td>{{yesno .Required}}</td><td>{{if .Default}}<code>{{.Default}}</code>{{end}}</td><td>{{join .Constraints ", "}}</td></tr>
+{{- end}}
+</table>
+{{- end}}
+{{- range .Objects}}
+<h2 id="{{anchor .Name}}">{{.Name}}</h2>
+{{- if .Description}}
+<p>{{.Description}}</p>
+{{- end}}
+{{- if .Fields}}
+{{- template "fields" (fieldsTable "Field" .Fields)}}
+{{- end}}
+{{- if .Messages}}
+<table>
+<tr><th>Message</th><th>Description</th><th>Produces artifacts</th><th>Side effects</th></tr>
+{{- range .Messages}}
+<tr><td><code>{{.Name}}</code></td><td>{{.Description}}</td><td>{{yesno .ProducesArtifacts}}</td><td>{{yesno .SideEffects}}</td></tr>
+{{- end}}
+</table>
+{{- range .Messages}}
+<h3>{{.Name}}</h3>
+{{- if .Description}}
+<p>{{.Description}}</p>
+{{- end}}
+{{- if .Request}}
+{{- template "fields" (fieldsTable "Request field" .Request)}}
+{{- end}}
+<p>Example payload:</p>
+<pre><code>{{.Example}}</code></pre>
+{{- end}}
+{{- else}}
+<p>This object supports no messages.</p>
+{{- end}}
+{{- end}}
+</body>
+</html>
+`))
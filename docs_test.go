@@ -0,0 +1,87 @@
+package prototype_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/aoldershaw/prototype-sdk-go"
+	"github.com/stretchr/testify/require"
+)
+
+type DocsRepository struct {
+	URI    string             `json:"uri" prototype:"required,url"`
+	Mode   string             `json:"mode,omitempty" prototype:"oneof=fast|slow,default=fast"`
+	Source prototype.Artifact `json:"source,omitempty" prototype:"dir"`
+}
+
+type DocsPushRequest struct {
+	Tags []string `json:"tags" prototype:"required,nonempty"`
+}
+
+func docsPrototype() prototype.Prototype {
+	return prototype.New(
+		prototype.WithIcon("mdi:git"),
+		prototype.WithObject(DocsRepository{},
+			prototype.WithDescription("A <git> repository."),
+			prototype.WithMessage("list", func(DocsRepository) []prototype.MessageResponse { return nil },
+				prototype.WithMessageDescription("List the branches."),
+			),
+			prototype.WithMessage("push", func(DocsRepository, DocsPushRequest) []prototype.MessageResponse { return nil },
+				prototype.WithSideEffects(),
+			),
+		),
+	)
+}
+
+func TestGenerateDocs(t *testing.T) {
+	t.Run("markdown", func(t *testing.T) {
+		var buf bytes.Buffer
+		err := docsPrototype().GenerateDocs(&buf, prototype.DocsMarkdown)
+		require.NoError(t, err)
+
+		docs := buf.String()
+		require.Contains(t, docs, "Icon: `mdi:git`")
+		require.Contains(t, docs, "- [DocsRepository](#docsrepository)")
+		require.Contains(t, docs, "## DocsRepository\n\nA <git> repository.")
+		require.Contains(t, docs, "| `uri` | string | yes |  | URL |")
+		require.Contains(t, docs, "| `mode` | string | no | `\"fast\"` | one of fast, slow |")
+		require.Contains(t, docs, "| `source` | artifact | no |  | directory |")
+		require.Contains(t, docs, "| `list` | List the branches. | no | no |")
+		require.Contains(t, docs, "| `push` |  | no | yes |")
+		require.Contains(t, docs, "| `tags` | array of string | yes |  | non-empty |")
+		require.Contains(t, docs, "```json\n{\n  \"tags\": [\n    \"example\"\n  ],\n  \"uri\": \"https://example.com\"\n}\n```")
+	})
+
+	t.Run("html", func(t *testing.T) {
+		var buf bytes.Buffer
+		err := docsPrototype().GenerateDocs(&buf, prototype.DocsHTML)
+		require.NoError(t, err)
+
+		docs := buf.String()
+		require.Contains(t, docs, `<h2 id="docsrepository">DocsRepository</h2>`)
+		require.Contains(t, docs, "<p>A &lt;git&gt; repository.</p>")
+		require.Contains(t, docs, "<tr><td><code>uri</code></td><td>string</td><td>yes</td><td></td><td>URL</td></tr>")
+		require.Contains(t, docs, "<h3>push</h3>")
+	})
+
+	t.Run("unsupported format", func(t *testing.T) {
+		err := docsPrototype().GenerateDocs(&bytes.Buffer{}, "pdf")
+		require.EqualError(t, err, `unsupported docs format "pdf"`)
+	})
+}
+
+func TestExecuteDocs(t *testing.T) {
+	var stdout bytes.Buffer
+	err := docsPrototype().ExecuteEnv(prototype.Environment{
+		Args:   []string{"--docs", "--format=html"},
+		Stdout: &stdout,
+	})
+	require.NoError(t, err)
+	require.Contains(t, stdout.String(), "<!DOCTYPE html>")
+
+	err = docsPrototype().ExecuteEnv(prototype.Environment{
+		Args:   []string{"--docs", "--format=pdf"},
+		Stdout: &stdout,
+	})
+	require.Equal(t, prototype.ErrorCodeInvalidRequest, prototype.AsError(err).Code)
+}
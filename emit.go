@@ -0,0 +1,92 @@
+package prototype
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+)
+
+// Emitter is passed to streaming message handlers, which emit each response
+// as it is produced rather than returning them all at once. This avoids
+// holding every response in memory for messages that produce many objects.
+type Emitter interface {
+	// Emit writes a response. If Emit fails, the handler should stop and
+	// return the error.
+	Emit(response MessageResponse) error
+}
+
+// EmitterFunc adapts a function to an Emitter.
+type EmitterFunc func(response MessageResponse) error
+
+func (f EmitterFunc) Emit(response MessageResponse) error {
+	return f(response)
+}
+
+var emitterType = reflect.TypeOf((*Emitter)(nil)).Elem()
+
+type emitterKey struct{}
+
+// streaming adapts a streaming execute function to the signature of
+// message.execute. When invoked by RunEmit, responses are emitted directly to
+// its Emitter (and no responses are returned). Otherwise, they are collected
+// and returned as they would be by a non-streaming handler.
+func streaming(execute func(context.Context, Object, Request, Emitter) error) func(context.Context, Object, Request) ([]MessageResponse, error) {
+	return func(ctx context.Context, object Object, request Request) ([]MessageResponse, error) {
+		if emitter, ok := ctx.Value(emitterKey{}).(Emitter); ok {
+			return nil, execute(ctx, object, request, emitter)
+		}
+		var responses []MessageResponse
+		err := execute(ctx, object, request, EmitterFunc(func(response MessageResponse) error {
+			responses = append(responses, response)
+			return nil
+		}))
+		return responses, err
+	}
+}
+
+// RunEmit is like RunContext, but passes each response to emitter rather than
+// returning them. Streaming handlers (see WithMessage) emit their responses
+// as they are produced, whereas the responses of other handlers are emitted
+// once the handler returns.
+//
+// Middleware wrapping a streaming handler observes no responses when invoked
+// by RunEmit.
+func (p Prototype) RunEmit(ctx context.Context, message string, request MessageRequest, emitter Emitter) error {
+	responses, err := p.RunContext(context.WithValue(ctx, emitterKey{}, emitter), message, request)
+	if err != nil {
+		return err
+	}
+	for _, response := range responses {
+		if err := emitter.Emit(response); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// encoderEmitter writes each response to a JSON stream, keeping track of how
+// many responses were written.
+type encoderEmitter struct {
+	encoder *json.Encoder
+	emitted int
+
+	// digests adds digests to the artifacts (see WithArtifactDigests), which
+	// are resolved against dir.
+	digests bool
+	dir     string
+}
+
+func (e *encoderEmitter) Emit(response MessageResponse) error {
+	if e.digests {
+		var err error
+		if response, err = addArtifactDigests(e.dir, response); err != nil {
+			return &Error{Code: ErrorCodeHandler, Message: fmt.Sprintf("digest artifacts: %s", err), err: err}
+		}
+	}
+	if err := e.encoder.Encode(response); err != nil {
+		return &Error{Code: ErrorCodeInternal, Message: fmt.Sprintf("write response: %s", err), err: err}
+	}
+	e.emitted++
+	return nil
+}
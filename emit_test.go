@@ -0,0 +1,94 @@
+package prototype_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/aoldershaw/prototype-sdk-go"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStreamingMessages(t *testing.T) {
+	errFailed := errors.New("failed")
+	var emitted []string
+	stream := func(n int, err error) func(SimpleObject, prototype.Emitter) error {
+		return func(object SimpleObject, emitter prototype.Emitter) error {
+			for i := 0; i < n; i++ {
+				emitted = append(emitted, "handler")
+				if err := emitter.Emit(prototype.MessageResponse{Object: map[string]interface{}{"i": i}}); err != nil {
+					return err
+				}
+			}
+			return err
+		}
+	}
+
+	proto := prototype.New(
+		prototype.WithObject(SimpleObject{},
+			prototype.WithMessage("stream", stream(3, nil)),
+			prototype.WithMessage("fail", stream(1, errFailed)),
+		),
+		prototype.ObjectOf[FooObject](
+			prototype.MessageStream("typed", func(object FooObject, _ prototype.NoRequest, emitter prototype.Emitter) error {
+				return emitter.Emit(prototype.MessageResponse{Object: map[string]interface{}{"foo": object.Foo}})
+			}),
+		),
+	)
+	simple := prototype.MessageRequest{Object: map[string]interface{}{"foo": "abc", "bar": 1}}
+	collect := prototype.EmitterFunc(func(response prototype.MessageResponse) error {
+		emitted = append(emitted, "emitter")
+		return nil
+	})
+
+	t.Run("Run collects the responses", func(t *testing.T) {
+		responses, err := proto.Run("stream", simple)
+		require.NoError(t, err)
+		require.Equal(t, []prototype.MessageResponse{
+			{Object: map[string]interface{}{"i": 0}},
+			{Object: map[string]interface{}{"i": 1}},
+			{Object: map[string]interface{}{"i": 2}},
+		}, responses)
+	})
+
+	t.Run("RunEmit emits each response as it is produced", func(t *testing.T) {
+		emitted = nil
+		err := proto.RunEmit(context.Background(), "stream", simple, collect)
+		require.NoError(t, err)
+		require.Equal(t, []string{"handler", "emitter", "handler", "emitter", "handler", "emitter"}, emitted)
+	})
+
+	t.Run("failure after emitting", func(t *testing.T) {
+		emitted = nil
+		err := proto.RunEmit(context.Background(), "fail", simple, collect)
+		require.ErrorIs(t, err, errFailed)
+		require.Equal(t, []string{"handler", "emitter"}, emitted)
+		require.Equal(t, prototype.ErrorCodeHandler, prototype.AsError(err).Code)
+	})
+
+	t.Run("emitter failure stops the handler", func(t *testing.T) {
+		emitted = nil
+		errWrite := errors.New("write failed")
+		err := proto.RunEmit(context.Background(), "stream", simple, prototype.EmitterFunc(func(prototype.MessageResponse) error {
+			return errWrite
+		}))
+		require.ErrorIs(t, err, errWrite)
+		require.Equal(t, []string{"handler"}, emitted)
+	})
+
+	t.Run("typed", func(t *testing.T) {
+		responses, err := proto.Run("typed", prototype.MessageRequest{Object: map[string]interface{}{"foo": "abc"}})
+		require.NoError(t, err)
+		require.Equal(t, []prototype.MessageResponse{{Object: map[string]interface{}{"foo": "abc"}}}, responses)
+	})
+}
+
+func TestStreamingMessageInvalidSignature(t *testing.T) {
+	require.Panics(t, func() {
+		prototype.New(prototype.WithObject(SimpleObject{},
+			prototype.WithMessage("stream", func(SimpleObject, prototype.Emitter) []prototype.MessageResponse {
+				return nil
+			}),
+		))
+	})
+}
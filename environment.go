@@ -0,0 +1,88 @@
+package prototype
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// Environment is the environment that Execute operates in. The zero value of
+// each field defaults to that of the process.
+type Environment struct {
+	// The command line arguments, excluding the program name.
+	Args []string
+
+	// Where the request is read from.
+	Stdin io.Reader
+
+	// Where output is written to in batch, validate and docs modes.
+	Stdout io.Writer
+
+	// Where diagnostics are written to.
+	Stderr io.Writer
+
+	// Looks up environment variables.
+	Getenv func(key string) string
+
+	// Opens the `response_path` for writing.
+	OpenResponse func(path string) (io.WriteCloser, error)
+
+	// The directory that artifacts (and a relative `response_path`) are
+	// resolved against (see ContextWithWorkingDir).
+	Dir string
+}
+
+func (env Environment) withDefaults() Environment {
+	if env.Args == nil && len(os.Args) > 0 {
+		env.Args = os.Args[1:]
+	}
+	if env.Stdin == nil {
+		env.Stdin = os.Stdin
+	}
+	if env.Stdout == nil {
+		env.Stdout = os.Stdout
+	}
+	if env.Stderr == nil {
+		env.Stderr = os.Stderr
+	}
+	if env.Getenv == nil {
+		env.Getenv = os.Getenv
+	}
+	if env.OpenResponse == nil {
+		env.OpenResponse = func(path string) (io.WriteCloser, error) {
+			return os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+		}
+	}
+	return env
+}
+
+// context returns the context that requests are handled in, in which
+// artifacts are resolved against Dir.
+func (env Environment) context() context.Context {
+	ctx := context.Background()
+	if env.Dir != "" {
+		ctx = ContextWithWorkingDir(ctx, env.Dir)
+	}
+	return ctx
+}
+
+// writeResponse opens the file at responsePath and writes the response to it
+// (see writeStream).
+func (env Environment) writeResponse(responsePath string, encode func(*json.Encoder) error) error {
+	if responsePath == "" {
+		return writeStream(io.Discard, encode)
+	}
+	if env.Dir != "" && !filepath.IsAbs(responsePath) {
+		responsePath = filepath.Join(env.Dir, responsePath)
+	}
+	responseFile, err := env.OpenResponse(responsePath)
+	if err != nil {
+		return &Error{Code: ErrorCodeInternal, Message: fmt.Sprintf("open response file: %s", err), err: err}
+	}
+	defer responseFile.Close()
+
+	return writeStream(responseFile, encode)
+}
@@ -0,0 +1,208 @@
+package prototype
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// ErrorCode identifies the class of failure reported in an ErrorResponse.
+type ErrorCode string
+
+const (
+	// ErrorCodeInternal is used for failures within the SDK itself, e.g. being
+	// unable to write to the response_path.
+	ErrorCodeInternal ErrorCode = "internal"
+	// ErrorCodeInvalidRequest is used when the payload on stdin is not a
+	// valid request.
+	ErrorCodeInvalidRequest ErrorCode = "invalid_request"
+	// ErrorCodeNoMatch is used when no registered object satisfies the
+	// payload.
+	ErrorCodeNoMatch ErrorCode = "no_match"
+	// ErrorCodeAmbiguous is used when multiple registered objects satisfy the
+	// payload.
+	ErrorCodeAmbiguous ErrorCode = "ambiguous"
+	// ErrorCodeHandler is used when a message handler returns an error.
+	ErrorCodeHandler ErrorCode = "handler_error"
+	// ErrorCodeHandlerPanic is used when a message handler panics.
+	ErrorCodeHandlerPanic ErrorCode = "handler_panic"
+	// ErrorCodeCanceled is used when a message handler is aborted, e.g. due
+	// to receiving SIGTERM.
+	ErrorCodeCanceled ErrorCode = "canceled"
+	// ErrorCodeInvalidDefinition is used when the definition of the
+	// prototype has issues (see Prototype.Validate).
+	ErrorCodeInvalidDefinition ErrorCode = "invalid_definition"
+)
+
+// ExitCode returns the process exit code associated with the ErrorCode.
+//
+// The exit codes are:
+//
+// * 1 - internal
+// * 2 - invalid_request
+// * 3 - no_match
+// * 4 - ambiguous
+// * 5 - handler_error
+// * 6 - handler_panic
+// * 7 - canceled
+// * 8 - invalid_definition
+func (c ErrorCode) ExitCode() int {
+	switch c {
+	case ErrorCodeInvalidRequest:
+		return 2
+	case ErrorCodeNoMatch:
+		return 3
+	case ErrorCodeAmbiguous:
+		return 4
+	case ErrorCodeHandler:
+		return 5
+	case ErrorCodeHandlerPanic:
+		return 6
+	case ErrorCodeCanceled:
+		return 7
+	case ErrorCodeInvalidDefinition:
+		return 8
+	default:
+		return 1
+	}
+}
+
+// Error is a structured failure. It is written to the `response_path` (wrapped
+// in an ErrorResponse) when Execute fails.
+type Error struct {
+	// The class of failure.
+	Code ErrorCode `json:"code"`
+
+	// A human readable description of the failure.
+	Message string `json:"message"`
+
+	// The name of the object type that failed, if known.
+	ObjectType string `json:"object_type,omitempty"`
+
+	// The JSON path of the field that failed, if known.
+	Field string `json:"field,omitempty"`
+
+	// Whether the same request may succeed if retried.
+	Retryable bool `json:"retryable"`
+
+	// Whether responses were written to the `response_path` before the
+	// failure, e.g. by a streaming handler (see Emitter). Such responses are
+	// incomplete and should not be used.
+	Partial bool `json:"partial,omitempty"`
+
+	err error
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+func (e *Error) Unwrap() error {
+	return e.err
+}
+
+// ErrorResponse is written to the `response_path` in place of a response when
+// the request fails.
+type ErrorResponse struct {
+	Error *Error `json:"error"`
+}
+
+// ExitCode returns the process exit code for an error returned by Execute. A
+// nil error results in 0.
+func ExitCode(err error) int {
+	if err == nil {
+		return 0
+	}
+	return AsError(err).Code.ExitCode()
+}
+
+// AsError converts an error returned by Run, Info or Execute into an *Error,
+// classifying it by its cause.
+func AsError(err error) *Error {
+	if err == nil {
+		return nil
+	}
+	var protoErr *Error
+	if errors.As(err, &protoErr) {
+		return protoErr
+	}
+
+	e := &Error{Code: ErrorCodeInternal, Message: err.Error(), err: err}
+
+	var noMatchErr NoMatchError
+	var ambiguousErr ambiguousError
+	var definitionErr DefinitionError
+	var handlerErr handlerError
+	var panicErr HandlerPanicError
+	var digestErr ArtifactDigestError
+	switch {
+	case errors.As(err, &noMatchErr):
+		e.Code = ErrorCodeNoMatch
+		if r, ok := noMatchErr.culprit(); ok {
+			e.ObjectType = r.ObjectType
+		}
+	case errors.As(err, &ambiguousErr):
+		e.Code = ErrorCodeAmbiguous
+	case errors.As(err, &definitionErr):
+		e.Code = ErrorCodeInvalidDefinition
+	case errors.As(err, &digestErr):
+		e.Code = ErrorCodeInvalidRequest
+	case errors.As(err, &panicErr):
+		e.Code = ErrorCodeHandlerPanic
+		if errors.As(err, &handlerErr) {
+			e.ObjectType = handlerErr.objectType.Name()
+		}
+	case errors.As(err, &handlerErr):
+		e.Code = ErrorCodeHandler
+		e.ObjectType = handlerErr.objectType.Name()
+		if errors.Is(err, context.Canceled) {
+			e.Code = ErrorCodeCanceled
+			e.Retryable = true
+		}
+	}
+
+	e.Field = fieldPath(err)
+	var retryableErr retryableError
+	if errors.As(err, &retryableErr) {
+		e.Retryable = true
+	}
+	return e
+}
+
+// Retryable marks an error returned by a message handler as retryable, which
+// is reported in the ErrorResponse.
+func Retryable(err error) error {
+	if err == nil {
+		return nil
+	}
+	return retryableError{err: err}
+}
+
+type retryableError struct {
+	err error
+}
+
+func (e retryableError) Error() string { return e.err.Error() }
+func (e retryableError) Unwrap() error { return e.err }
+
+type ambiguousError struct {
+	types []reflect.Type
+}
+
+func (e ambiguousError) Error() string {
+	names := make([]string, len(e.types))
+	for i, t := range e.types {
+		names[i] = t.String()
+	}
+	return fmt.Sprintf("object is ambiguous - satisfies types [%s]", strings.Join(names, " "))
+}
+
+type handlerError struct {
+	objectType reflect.Type
+	err        error
+}
+
+func (e handlerError) Error() string { return fmt.Sprintf("invoke: %s", e.err) }
+func (e handlerError) Unwrap() error { return e.err }
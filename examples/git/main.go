@@ -7,19 +7,29 @@ import (
 func Prototype() prototype.Prototype {
 	return prototype.New(
 		prototype.WithObject(Repository{},
-			prototype.WithMessage("list", (Repository).ListBranches),
+			prototype.WithDescription("A git repository."),
+			prototype.WithMessage("list", (Repository).ListBranches,
+				prototype.WithMessageDescription("List the branches in the repository."),
+			),
 		),
 		prototype.WithObject(Branch{},
-			prototype.WithMessage("list", (Branch).ListCommits),
-			prototype.WithMessage("put", (Branch).Push),
+			prototype.WithDescription("A branch of a git repository."),
+			prototype.WithMessage("list", (Branch).ListCommits,
+				prototype.WithMessageDescription("List the commits on the branch."),
+			),
+			prototype.WithMessage("put", (Branch).Push,
+				prototype.WithMessageDescription("Push a new commit to the branch."),
+				prototype.WithSideEffects(),
+			),
+		),
+		prototype.WithObject(Commit{},
+			prototype.WithDescription("A commit on a branch of a git repository."),
+			prototype.WithInheritedMessages(),
 		),
-		prototype.WithObject(Commit{}),
 		prototype.WithIcon("mdi:git"),
 	)
 }
 
 func main() {
-	if err := Prototype().Execute(); err != nil {
-		panic(err)
-	}
+	Prototype().Main()
 }
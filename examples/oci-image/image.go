@@ -1,22 +1,36 @@
 package main
 
 import (
+	"context"
 	"fmt"
+	"io/fs"
+	"path"
 
 	prototype "github.com/aoldershaw/prototype-sdk-go"
 )
 
 type OCIImage struct {
-	Context        string            `json:"context" prototype:"required"`
-	ContextInputs  map[string]string `json:"context_inputs,omitempty"`
-	DockerfilePath string            `json:"dockerfile,omitempty"`
+	Context        prototype.Artifact            `json:"context" prototype:"required,dir"`
+	ContextInputs  map[string]prototype.Artifact `json:"context_inputs,omitempty" prototype:"dir"`
+	DockerfilePath string                        `json:"dockerfile,omitempty" prototype:"default=Dockerfile"`
 }
 
-func (o OCIImage) Build() ([]prototype.MessageResponse, error) {
-	fmt.Println("building an image!", o.Context)
+func (o OCIImage) Build(ctx context.Context) ([]prototype.MessageResponse, error) {
+	dockerfile, err := fs.Stat(o.Context.FS(ctx), path.Clean(o.DockerfilePath))
+	if err != nil {
+		return nil, err
+	}
+	fmt.Println("building an image!", o.Context, dockerfile.Name())
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	image, err := prototype.NewArtifactDir(ctx, "image")
+	if err != nil {
+		return nil, err
+	}
 	return []prototype.MessageResponse{{
 		Object: map[string]interface{}{
-			"image": prototype.Artifact("./image"),
+			"image": image,
 		}},
 	}, nil
 }
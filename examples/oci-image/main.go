@@ -7,15 +7,19 @@ import (
 func Prototype() prototype.Prototype {
 	return prototype.New(
 		prototype.WithObject(OCIImage{},
-			prototype.WithMessage("build", (OCIImage).Build),
-			prototype.WithMessage("run-stage", (OCIImage).RunStage),
+			prototype.WithDescription("An OCI image built from a Dockerfile."),
+			prototype.WithMessage("build", (OCIImage).Build,
+				prototype.WithMessageDescription("Build the image."),
+				prototype.WithArtifacts(),
+			),
+			prototype.WithMessage("run-stage", (OCIImage).RunStage,
+				prototype.WithMessageDescription("Run a single stage of the Dockerfile."),
+			),
 		),
 		prototype.WithIcon("mdi:docker"),
 	)
 }
 
 func main() {
-	if err := Prototype().Execute(); err != nil {
-		panic(err)
-	}
+	Prototype().Main()
 }
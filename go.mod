@@ -1,8 +1,14 @@
 module github.com/aoldershaw/prototype-sdk-go
 
-go 1.16
+go 1.18
 
 require (
 	github.com/mitchellh/reflectwalk v1.0.1
-	github.com/stretchr/testify v1.7.0 // indirect
+	github.com/stretchr/testify v1.7.0
+	gopkg.in/yaml.v3 v3.0.1
+)
+
+require (
+	github.com/davecgh/go-spew v1.1.0 // indirect
+	github.com/pmezard/go-difflib v1.0.0 // indirect
 )
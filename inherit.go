@@ -0,0 +1,139 @@
+package prototype
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+)
+
+// WithInheritedMessages makes the messages of registered objects that are
+// embedded in this object available on this object. When an inherited message
+// is invoked, the embedded value is extracted from the object and passed to
+// the handler.
+//
+// As with promoted fields and methods in Go, messages from shallower embedded
+// objects take precedence over deeper ones, and a message inherited from
+// multiple embedded objects at the same depth is not inherited at all. A
+// message registered on this object overrides any inherited message of the
+// same name. Inherited messages can be hidden with WithoutMessage.
+func WithInheritedMessages() ObjectOption {
+	return func(o *objectWrapper) {
+		o.inherit = true
+	}
+}
+
+// WithoutMessage hides an inherited message (see WithInheritedMessages).
+func WithoutMessage(name string) ObjectOption {
+	return func(o *objectWrapper) {
+		if o.hidden == nil {
+			o.hidden = map[string]bool{}
+		}
+		o.hidden[name] = true
+	}
+}
+
+// inheritMessages adds inherited messages to each object that opted in to
+// WithInheritedMessages. Only messages registered directly on an embedded
+// object are inherited, since the embedded objects are walked recursively.
+func (p *Prototype) inheritMessages() {
+	ownMessages := map[reflect.Type][]message{}
+	for _, wrapper := range p.objects {
+		rt := reflect.TypeOf(wrapper.object)
+		ownMessages[rt] = append(ownMessages[rt], wrapper.messages...)
+	}
+
+	for i, wrapper := range p.objects {
+		if !wrapper.inherit {
+			continue
+		}
+		for _, inherited := range inheritableMessages(reflect.TypeOf(wrapper.object), ownMessages) {
+			if wrapper.supports(inherited.name) || wrapper.hidden[inherited.name] {
+				continue
+			}
+			p.objects[i].messages = append(p.objects[i].messages, inherited)
+		}
+	}
+}
+
+type embeddedMessage struct {
+	message
+	index []int
+}
+
+// inheritableMessages walks the embedded structs of rt breadth first, and
+// returns the messages of those that are registered objects, adapted to be
+// invoked on rt.
+func inheritableMessages(rt reflect.Type, ownMessages map[reflect.Type][]message) []message {
+	var inherited []message
+	seen := map[string]bool{}
+
+	type embedded struct {
+		rt    reflect.Type
+		index []int
+	}
+	level := []embedded{{rt: rt}}
+	visited := map[reflect.Type]bool{rt: true}
+	for len(level) > 0 {
+		var next []embedded
+		var candidates []embeddedMessage
+		counts := map[string]int{}
+		for _, e := range level {
+			for i := 0; i < e.rt.NumField(); i++ {
+				field := e.rt.Field(i)
+				if !field.Anonymous || !field.IsExported() {
+					continue
+				}
+				fieldType := field.Type
+				if fieldType.Kind() == reflect.Ptr {
+					fieldType = fieldType.Elem()
+				}
+				if fieldType.Kind() != reflect.Struct || visited[fieldType] {
+					continue
+				}
+				visited[fieldType] = true
+				index := append(append([]int(nil), e.index...), i)
+				next = append(next, embedded{rt: fieldType, index: index})
+				for _, msg := range ownMessages[fieldType] {
+					candidates = append(candidates, embeddedMessage{message: msg, index: index})
+					counts[msg.name]++
+				}
+			}
+		}
+		for _, candidate := range candidates {
+			if seen[candidate.name] {
+				continue
+			}
+			if counts[candidate.name] == 1 {
+				inherited = append(inherited, candidate.adapt())
+			}
+		}
+		// ambiguous messages at this depth also hide deeper messages
+		for name := range counts {
+			seen[name] = true
+		}
+		level = next
+	}
+	return inherited
+}
+
+// adapt returns a message that extracts the embedded object before invoking
+// the message.
+func (e embeddedMessage) adapt() message {
+	msg := e.message
+	execute := e.execute
+	msg.execute = func(ctx context.Context, object Object, request Request) ([]MessageResponse, error) {
+		embedded, err := reflect.ValueOf(object).FieldByIndexErr(e.index)
+		if err == nil && embedded.Kind() == reflect.Ptr {
+			if embedded.IsNil() {
+				err = fmt.Errorf("embedded %s is nil", embedded.Type())
+			} else {
+				embedded = embedded.Elem()
+			}
+		}
+		if err != nil {
+			return nil, fmt.Errorf("inherited message %q: %w", e.name, err)
+		}
+		return execute(ctx, embedded.Interface(), request)
+	}
+	return msg
+}
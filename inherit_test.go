@@ -0,0 +1,84 @@
+package prototype_test
+
+import (
+	"testing"
+
+	"github.com/aoldershaw/prototype-sdk-go"
+	"github.com/stretchr/testify/require"
+)
+
+type Commit struct {
+	Branch
+	Ref string `json:"ref" prototype:"required"`
+}
+
+func TestInheritedMessages(t *testing.T) {
+	respond := func(value string) []prototype.MessageResponse {
+		return []prototype.MessageResponse{{Object: map[string]interface{}{"value": value}}}
+	}
+
+	options := func(commitOptions ...prototype.ObjectOption) []prototype.Option {
+		return []prototype.Option{
+			prototype.WithObject(Repository{},
+				prototype.WithMessage("list", func(r Repository) []prototype.MessageResponse { return respond("repo list " + r.URI) }),
+				prototype.WithMessage("check", func(r Repository) []prototype.MessageResponse { return respond("repo check " + r.URI) }),
+			),
+			prototype.WithObject(Branch{},
+				prototype.WithMessage("list", func(b Branch) []prototype.MessageResponse { return respond("branch list " + b.Branch) }),
+				prototype.WithMessage("put", func(b Branch, r OptionalParams) []prototype.MessageResponse { return respond("branch put " + r.Baz) }),
+			),
+			prototype.WithObject(Commit{}, commitOptions...),
+		}
+	}
+	commit := map[string]interface{}{
+		"uri":    "https://example.com",
+		"branch": "main",
+		"ref":    "abc",
+	}
+
+	t.Run("disabled by default", func(t *testing.T) {
+		info, err := prototype.New(options()...).Info(prototype.InfoRequest{Object: commit})
+		require.NoError(t, err)
+		require.Empty(t, info.Messages)
+	})
+
+	t.Run("inherits from the closest embedded object", func(t *testing.T) {
+		proto := prototype.New(options(prototype.WithInheritedMessages())...)
+
+		info, err := proto.Info(prototype.InfoRequest{Object: commit})
+		require.NoError(t, err)
+		require.ElementsMatch(t, []string{"list", "put", "check"}, info.Messages)
+
+		response, err := proto.Run("list", prototype.MessageRequest{Object: commit})
+		require.NoError(t, err)
+		require.Equal(t, respond("branch list main"), response)
+
+		response, err = proto.Run("check", prototype.MessageRequest{Object: commit})
+		require.NoError(t, err)
+		require.Equal(t, respond("repo check https://example.com"), response)
+
+		withRequest := map[string]interface{}{"baz": "hello"}
+		for k, v := range commit {
+			withRequest[k] = v
+		}
+		response, err = proto.Run("put", prototype.MessageRequest{Object: withRequest})
+		require.NoError(t, err)
+		require.Equal(t, respond("branch put hello"), response)
+	})
+
+	t.Run("override and hide", func(t *testing.T) {
+		proto := prototype.New(options(
+			prototype.WithInheritedMessages(),
+			prototype.WithoutMessage("put"),
+			prototype.WithMessage("list", func(c Commit) []prototype.MessageResponse { return respond("commit list " + c.Ref) }),
+		)...)
+
+		info, err := proto.Info(prototype.InfoRequest{Object: commit})
+		require.NoError(t, err)
+		require.ElementsMatch(t, []string{"list", "check"}, info.Messages)
+
+		response, err := proto.Run("list", prototype.MessageRequest{Object: commit})
+		require.NoError(t, err)
+		require.Equal(t, respond("commit list abc"), response)
+	})
+}
@@ -0,0 +1,47 @@
+// Package prototypebin builds prototype binaries for the commands that invoke
+// them (prototype-vet, prototype-run and prototype-docs).
+package prototypebin
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+)
+
+// Build returns the absolute path of the prototype binary for target, building
+// it with `go build` first if target is not an executable. Output of the build
+// is written to stderr. cleanup removes the built binary, and must be called
+// once it is no longer needed.
+//
+// If target is a directory, the package is built from within it, so that it
+// may belong to a different module than the working directory.
+func Build(target string) (binary string, cleanup func(), err error) {
+	if IsExecutable(target) {
+		binary, err := filepath.Abs(target)
+		return binary, func() {}, err
+	}
+	dir, err := os.MkdirTemp("", "prototype-bin")
+	if err != nil {
+		return "", nil, err
+	}
+	cleanup = func() { os.RemoveAll(dir) }
+	binary = filepath.Join(dir, "prototype")
+	cmd := exec.Command("go", "build", "-o", binary, target)
+	if info, err := os.Stat(target); err == nil && info.IsDir() {
+		cmd = exec.Command("go", "build", "-o", binary, ".")
+		cmd.Dir = target
+	}
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		cleanup()
+		return "", nil, fmt.Errorf("build: %w", err)
+	}
+	return binary, cleanup, nil
+}
+
+// IsExecutable returns whether path is a regular file that may be executed.
+func IsExecutable(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && info.Mode().IsRegular() && info.Mode().Perm()&0111 != 0
+}
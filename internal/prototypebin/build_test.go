@@ -0,0 +1,37 @@
+package prototypebin_test
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/aoldershaw/prototype-sdk-go/internal/prototypebin"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBuild(t *testing.T) {
+	// a package in a different module than the working directory
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "go.mod"), []byte("module example.com/proto\n\ngo 1.18\n"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "main.go"), []byte("package main\n\nfunc main() { println(\"built\") }\n"), 0644))
+
+	binary, cleanup, err := prototypebin.Build(dir)
+	require.NoError(t, err)
+	require.True(t, filepath.IsAbs(binary))
+	require.True(t, prototypebin.IsExecutable(binary))
+	output, err := exec.Command(binary).CombinedOutput()
+	require.NoError(t, err)
+	require.Equal(t, "built\n", string(output))
+
+	// executables are used as is
+	prebuilt, prebuiltCleanup, err := prototypebin.Build(binary)
+	require.NoError(t, err)
+	prebuiltCleanup()
+	require.Equal(t, binary, prebuilt)
+	require.FileExists(t, binary)
+
+	cleanup()
+	require.NoFileExists(t, binary)
+	require.False(t, prototypebin.IsExecutable(dir))
+}
@@ -0,0 +1,384 @@
+package prototype
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// IssueKind identifies the class of problem found by Validate.
+type IssueKind string
+
+const (
+	// IssueAmbiguous is reported when a payload can satisfy multiple objects
+	// for the same message, and Run cannot resolve which to use.
+	IssueAmbiguous IssueKind = "ambiguous"
+	// IssueUnreachable is reported when a message can never be invoked.
+	IssueUnreachable IssueKind = "unreachable"
+	// IssueNoMessages is reported for objects that support no messages.
+	IssueNoMessages IssueKind = "no_messages"
+)
+
+// Issue is a problem with the definition of a prototype, found by Validate.
+type Issue struct {
+	Kind IssueKind
+
+	// The name of the message, if the issue concerns a message.
+	Message string
+
+	// The names of the object types involved.
+	ObjectTypes []string
+
+	// An example payload that triggers the issue, if applicable.
+	Payload map[string]interface{}
+
+	// A human readable description of the issue.
+	Reason string
+}
+
+func (i Issue) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s: %s", i.Kind, strings.Join(i.ObjectTypes, ", "))
+	if i.Message != "" {
+		fmt.Fprintf(&b, " (message %q)", i.Message)
+	}
+	fmt.Fprintf(&b, ": %s", i.Reason)
+	if i.Payload != nil {
+		payload, _ := json.Marshal(i.Payload)
+		fmt.Fprintf(&b, "\n\texample payload: %s", payload)
+	}
+	return b.String()
+}
+
+// DefinitionError is returned by Validate when the definition of a prototype
+// has issues.
+type DefinitionError struct {
+	Issues []Issue
+}
+
+func (e DefinitionError) Error() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "prototype definition has %d issue(s):", len(e.Issues))
+	for _, issue := range e.Issues {
+		b.WriteString("\n")
+		b.WriteString(issue.String())
+	}
+	return b.String()
+}
+
+// Validate statically analyzes the registered objects and the requests of
+// their messages, and returns a DefinitionError describing any issues:
+//
+//   - a payload can satisfy multiple objects for the same message, and the
+//     ambiguity cannot be resolved by Run (see Run), i.e. the objects require
+//     the same number of keys and have the same priority. The issue includes
+//     an example payload
+//   - a message can never be invoked, e.g. because another object with a
+//     higher priority satisfies every payload that it does, or its request
+//     requires a key that is consumed by the object
+//   - an object supports no messages
+//
+// The analysis is based on the JSON keys of the objects and requests, and
+// their required fields. Validation options other than required and nonempty
+// are not considered, so an ambiguity may be ruled out in practice by
+// stricter validation.
+func (p Prototype) Validate() error {
+	var issues []Issue
+	var candidates []lintCandidate
+	for _, wrapper := range p.objects {
+		rt := reflect.TypeOf(wrapper.object)
+		if len(wrapper.messages) == 0 {
+			issues = append(issues, Issue{
+				Kind:        IssueNoMessages,
+				ObjectTypes: []string{rt.Name()},
+				Reason:      "object supports no messages",
+			})
+		}
+		objectKeys := lintKeysOf(rt)
+		for _, msg := range wrapper.messages {
+			candidate := lintCandidate{
+				objectType: rt,
+				message:    msg.name,
+				priority:   wrapper.priority,
+				keys:       map[string]lintKey{},
+			}
+			for name, key := range objectKeys {
+				candidate.keys[name] = key
+			}
+			var consumed []string
+			for name, key := range lintKeysOf(msg.requestType) {
+				if _, ok := objectKeys[name]; ok {
+					if key.required {
+						consumed = append(consumed, name)
+					}
+					continue
+				}
+				candidate.keys[name] = key
+			}
+			if len(consumed) > 0 {
+				sort.Strings(consumed)
+				issues = append(issues, Issue{
+					Kind:        IssueUnreachable,
+					Message:     msg.name,
+					ObjectTypes: []string{rt.Name()},
+					Reason:      fmt.Sprintf("request requires %s, which is consumed by the object", strings.Join(consumed, ", ")),
+				})
+				continue
+			}
+			candidates = append(candidates, candidate)
+		}
+	}
+
+	for i, a := range candidates {
+		for _, b := range candidates[i+1:] {
+			if a.message != b.message {
+				continue
+			}
+			issues = append(issues, p.lintPair(a, b)...)
+		}
+	}
+
+	if len(issues) == 0 {
+		return nil
+	}
+	return DefinitionError{Issues: issues}
+}
+
+// lintCandidate is a message of an object, along with the JSON keys that it
+// consumes (from both the object and the request).
+type lintCandidate struct {
+	objectType reflect.Type
+	message    string
+	priority   int
+	keys       map[string]lintKey
+}
+
+// requiredKeys returns the number of keys that the candidate requires, which
+// Run uses to rank candidates.
+func (c lintCandidate) requiredKeys() int {
+	var n int
+	for _, key := range c.keys {
+		if key.required {
+			n++
+		}
+	}
+	return n
+}
+
+type lintKey struct {
+	field    jsonField
+	required bool
+}
+
+// lintKeysOf returns the JSON keys of a struct type, or nil if rt is not a
+// struct.
+func lintKeysOf(rt reflect.Type) map[string]lintKey {
+	for rt != nil && rt.Kind() == reflect.Ptr {
+		rt = rt.Elem()
+	}
+	if rt == nil || rt.Kind() != reflect.Struct {
+		return nil
+	}
+	keys := map[string]lintKey{}
+	for _, field := range jsonFields(rt) {
+		tag, _ := parseFieldTag(field.StructField)
+		keys[field.name] = lintKey{field: field, required: tag.required || tag.nonempty}
+	}
+	return keys
+}
+
+// lintPair checks whether a payload can satisfy both candidates for the same
+// message.
+func (p Prototype) lintPair(a, b lintCandidate) []Issue {
+	// a payload satisfies a candidate if it contains all of its required keys,
+	// and no keys that it does not consume
+	payloadKeys := map[string][]jsonField{}
+	for _, c := range []lintCandidate{a, b} {
+		for name, key := range c.keys {
+			if key.required {
+				payloadKeys[name] = nil
+			}
+		}
+	}
+	for name := range payloadKeys {
+		keyA, inA := a.keys[name]
+		keyB, inB := b.keys[name]
+		if !inA || !inB || !compatibleTypes(keyA.field.Type, keyB.field.Type) {
+			return nil
+		}
+		payloadKeys[name] = []jsonField{keyA.field, keyB.field}
+	}
+	if !p.strict && a.requiredKeys() != b.requiredKeys() {
+		// Run prefers the candidate that requires more keys, and the other
+		// still handles payloads with only its own required keys
+		return nil
+	}
+
+	objectTypes := []string{a.objectType.Name(), b.objectType.Name()}
+	if a.priority == b.priority || p.strict {
+		payload := map[string]interface{}{}
+		for name, fields := range payloadKeys {
+			payload[name] = sharedExample(fields)
+		}
+		return []Issue{{
+			Kind:        IssueAmbiguous,
+			Message:     a.message,
+			ObjectTypes: objectTypes,
+			Payload:     payload,
+			Reason:      "a payload can satisfy both objects",
+		}}
+	}
+
+	// the candidate with the lower priority is unreachable if the other
+	// satisfies every payload that it does
+	low, high := a, b
+	if low.priority > high.priority {
+		low, high = high, low
+	}
+	for name := range low.keys {
+		if _, ok := high.keys[name]; !ok {
+			return nil
+		}
+	}
+	for name, key := range high.keys {
+		if key.required && !low.keys[name].required {
+			return nil
+		}
+	}
+	return []Issue{{
+		Kind:        IssueUnreachable,
+		Message:     low.message,
+		ObjectTypes: []string{low.objectType.Name(), high.objectType.Name()},
+		Reason:      fmt.Sprintf("every payload is also satisfied by %s, which has a higher priority", high.objectType.Name()),
+	}}
+}
+
+// compatibleTypes returns whether a JSON value could decode into both types.
+func compatibleTypes(a, b reflect.Type) bool {
+	kind := func(rt reflect.Type) string {
+		schema := schemaForType(rt)
+		if schema.Type == "integer" {
+			// an integer is also a number
+			return "number"
+		}
+		return schema.Type
+	}
+	kindA, kindB := kind(a), kind(b)
+	return kindA == "" || kindB == "" || kindA == kindB
+}
+
+// sharedExample returns an example JSON value that is valid for all of the
+// fields, if one of their examples is. Otherwise, the example of the first
+// field is returned.
+func sharedExample(fields []jsonField) interface{} {
+	var examples []interface{}
+	for _, field := range fields {
+		example := newExampleBuilder().build(field.Type, field.StructField)
+		if validForAll(example, fields) {
+			return example
+		}
+		examples = append(examples, example)
+	}
+	return examples[0]
+}
+
+func validForAll(example interface{}, fields []jsonField) bool {
+	payload, err := json.Marshal(example)
+	if err != nil {
+		return false
+	}
+	for _, field := range fields {
+		rv := reflect.New(field.Type)
+		if err := json.Unmarshal(payload, rv.Interface()); err != nil {
+			return false
+		}
+		tag, _ := parseFieldTag(field.StructField)
+		if _, ok := tag.validate(rv.Elem()); !ok {
+			return false
+		}
+	}
+	return true
+}
+
+type exampleBuilder struct {
+	// visiting is used to avoid infinitely recursing into recursive types.
+	visiting map[reflect.Type]bool
+}
+
+func newExampleBuilder() *exampleBuilder {
+	return &exampleBuilder{visiting: map[reflect.Type]bool{}}
+}
+
+// build returns an example JSON value for type rt that satisfies the required
+// and common validation options of the field's tag.
+func (b *exampleBuilder) build(rt reflect.Type, field reflect.StructField) interface{} {
+	tag, _ := parseFieldTag(field)
+	for rt.Kind() == reflect.Ptr {
+		rt = rt.Elem()
+	}
+	if len(tag.oneof) > 0 {
+		if n, err := strconv.ParseFloat(tag.oneof[0], 64); err == nil && rt.Kind() != reflect.String {
+			return n
+		}
+		return tag.oneof[0]
+	}
+	switch {
+	case rt == artifactType:
+		return map[string]interface{}{"artifact": "example"}
+	case rt == timeType:
+		return "2006-01-02T15:04:05Z"
+	}
+
+	switch rt.Kind() {
+	case reflect.Bool:
+		return true
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		if tag.min != nil && *tag.min > 1 {
+			return *tag.min
+		}
+		return 1
+	case reflect.String:
+		switch {
+		case tag.url:
+			return "https://example.com"
+		case tag.semver:
+			return "1.0.0"
+		case tag.duration:
+			return "1m"
+		}
+		example := "example"
+		if tag.length != nil {
+			return strings.Repeat("x", *tag.length)
+		}
+		if tag.min != nil && float64(len(example)) < *tag.min {
+			return strings.Repeat("x", int(*tag.min))
+		}
+		return example
+	case reflect.Slice, reflect.Array:
+		if rt.Elem().Kind() == reflect.Uint8 && rt.Kind() == reflect.Slice {
+			return "ZXhhbXBsZQ=="
+		}
+		return []interface{}{b.build(rt.Elem(), reflect.StructField{})}
+	case reflect.Map:
+		return map[string]interface{}{"key": b.build(rt.Elem(), reflect.StructField{})}
+	case reflect.Struct:
+		object := map[string]interface{}{}
+		if b.visiting[rt] {
+			return object
+		}
+		b.visiting[rt] = true
+		defer delete(b.visiting, rt)
+		for name, key := range lintKeysOf(rt) {
+			if key.required {
+				object[name] = b.build(key.field.Type, key.field.StructField)
+			}
+		}
+		return object
+	}
+	return "example"
+}
@@ -0,0 +1,145 @@
+package prototype_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/aoldershaw/prototype-sdk-go"
+	"github.com/stretchr/testify/require"
+)
+
+type LintRepo struct {
+	URI string `json:"uri" prototype:"required,url"`
+}
+
+type LintMirror struct {
+	URI    string `json:"uri" prototype:"required"`
+	Branch string `json:"branch,omitempty"`
+}
+
+type LintBranch struct {
+	URI    string `json:"uri" prototype:"required"`
+	Branch string `json:"branch" prototype:"required"`
+}
+
+type LintBranchFilter struct {
+	Branch string `json:"branch"`
+}
+
+type LintImage struct {
+	Repository string `json:"repository" prototype:"required"`
+}
+
+type LintTagRequest struct {
+	Repository string `json:"repository" prototype:"required"`
+	Tag        string `json:"tag" prototype:"required"`
+}
+
+type LintEmpty struct{}
+
+func TestValidateDefinition(t *testing.T) {
+	for _, tt := range []struct {
+		desc    string
+		options []prototype.Option
+		issues  []prototype.Issue
+	}{
+		{
+			desc: "distinct objects",
+			options: []prototype.Option{
+				prototype.WithObject(LintRepo{}, prototype.WithMessage("list", func(LintRepo) []prototype.MessageResponse { return nil })),
+				prototype.WithObject(LintImage{}, prototype.WithMessage("list", func(LintImage) []prototype.MessageResponse { return nil })),
+			},
+		},
+		{
+			desc: "ambiguous objects",
+			options: []prototype.Option{
+				prototype.WithObject(LintRepo{}, prototype.WithMessage("list", func(LintRepo) []prototype.MessageResponse { return nil })),
+				prototype.WithObject(LintMirror{}, prototype.WithMessage("list", func(LintMirror) []prototype.MessageResponse { return nil })),
+			},
+			issues: []prototype.Issue{{
+				Kind:        prototype.IssueAmbiguous,
+				Message:     "list",
+				ObjectTypes: []string{"LintRepo", "LintMirror"},
+				Payload:     map[string]interface{}{"uri": "https://example.com"},
+				Reason:      "a payload can satisfy both objects",
+			}},
+		},
+		{
+			desc: "ambiguity resolved by priority",
+			options: []prototype.Option{
+				prototype.WithObject(LintRepo{}, prototype.WithMessage("list", func(LintRepo) []prototype.MessageResponse { return nil })),
+				prototype.WithObject(LintMirror{}, prototype.WithPriority(1), prototype.WithMessage("list", func(LintMirror) []prototype.MessageResponse { return nil })),
+			},
+			issues: []prototype.Issue{{
+				Kind:        prototype.IssueUnreachable,
+				Message:     "list",
+				ObjectTypes: []string{"LintRepo", "LintMirror"},
+				Reason:      "every payload is also satisfied by LintMirror, which has a higher priority",
+			}},
+		},
+		{
+			desc: "ambiguity resolved by required keys",
+			options: []prototype.Option{
+				prototype.WithObject(LintRepo{}, prototype.WithMessage("list", func(LintRepo, LintBranchFilter) []prototype.MessageResponse { return nil })),
+				prototype.WithObject(LintBranch{}, prototype.WithMessage("list", func(LintBranch) []prototype.MessageResponse { return nil })),
+			},
+		},
+		{
+			desc: "lower priority object is still reachable",
+			options: []prototype.Option{
+				prototype.WithObject(LintRepo{}, prototype.WithPriority(1), prototype.WithMessage("list", func(LintRepo) []prototype.MessageResponse { return nil })),
+				prototype.WithObject(LintMirror{}, prototype.WithMessage("list", func(LintMirror) []prototype.MessageResponse { return nil })),
+			},
+		},
+		{
+			desc: "ambiguity with strict matching",
+			options: []prototype.Option{
+				prototype.WithStrictMatching(),
+				prototype.WithObject(LintRepo{}, prototype.WithMessage("list", func(LintRepo) []prototype.MessageResponse { return nil })),
+				prototype.WithObject(LintMirror{}, prototype.WithPriority(1), prototype.WithMessage("list", func(LintMirror) []prototype.MessageResponse { return nil })),
+			},
+			issues: []prototype.Issue{{
+				Kind:        prototype.IssueAmbiguous,
+				Message:     "list",
+				ObjectTypes: []string{"LintRepo", "LintMirror"},
+				Payload:     map[string]interface{}{"uri": "https://example.com"},
+				Reason:      "a payload can satisfy both objects",
+			}},
+		},
+		{
+			desc: "request requires a key consumed by the object",
+			options: []prototype.Option{
+				prototype.WithObject(LintImage{}, prototype.WithMessage("tag", func(LintImage, LintTagRequest) []prototype.MessageResponse { return nil })),
+			},
+			issues: []prototype.Issue{{
+				Kind:        prototype.IssueUnreachable,
+				Message:     "tag",
+				ObjectTypes: []string{"LintImage"},
+				Reason:      "request requires repository, which is consumed by the object",
+			}},
+		},
+		{
+			desc: "object with no messages",
+			options: []prototype.Option{
+				prototype.WithObject(LintEmpty{}),
+			},
+			issues: []prototype.Issue{{
+				Kind:        prototype.IssueNoMessages,
+				ObjectTypes: []string{"LintEmpty"},
+				Reason:      "object supports no messages",
+			}},
+		},
+	} {
+		t.Run(tt.desc, func(t *testing.T) {
+			err := prototype.New(tt.options...).Validate()
+			if tt.issues == nil {
+				require.NoError(t, err)
+				return
+			}
+			var definitionErr prototype.DefinitionError
+			require.True(t, errors.As(err, &definitionErr), "expected DefinitionError, got %v", err)
+			require.Equal(t, tt.issues, definitionErr.Issues)
+			require.Equal(t, prototype.ErrorCodeInvalidDefinition, prototype.AsError(err).Code)
+		})
+	}
+}
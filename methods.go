@@ -0,0 +1,98 @@
+package prototype
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"unicode"
+)
+
+// MessageNamer may be implemented by objects registered with
+// WithObjectMethods to override the names of the messages derived from its
+// methods. PrototypeMessages maps method names to message names. Mapping a
+// method to "-" excludes it.
+type MessageNamer interface {
+	PrototypeMessages() map[string]string
+}
+
+var messageResponsesType = reflect.TypeOf([]MessageResponse(nil))
+
+// WithObjectMethods registers an object, along with a message for each of its
+// exported methods (including those promoted from embedded structs) that
+// returns []MessageResponse, or that takes a prototype.Emitter as its last
+// argument and returns an error. Methods must satisfy one of the signatures
+// accepted by WithMessage, where the object is the receiver.
+//
+// Messages are named by converting the method name to kebab-case (e.g.
+// ListBranches becomes list-branches), unless overridden by MessageNamer.
+//
+// WithObjectMethods panics if a method returning []MessageResponse has an
+// invalid signature, or if MessageNamer refers to a method that does not
+// exist.
+func WithObjectMethods(object Object, options ...ObjectOption) Option {
+	rt := reflect.TypeOf(object)
+
+	var names map[string]string
+	if namer, ok := object.(MessageNamer); ok {
+		names = namer.PrototypeMessages()
+	}
+	for methodName := range names {
+		if _, ok := rt.MethodByName(methodName); !ok {
+			panic(fmt.Errorf("%s: PrototypeMessages refers to unknown method %s", rt, methodName))
+		}
+	}
+
+	var messageOptions []ObjectOption
+	for i := 0; i < rt.NumMethod(); i++ {
+		method := rt.Method(i)
+		if method.Name == "PrototypeMessages" {
+			continue
+		}
+		name, overridden := names[method.Name]
+		if name == "-" {
+			continue
+		}
+		if !overridden {
+			if !isHandlerMethod(method.Type) {
+				// not a message handler
+				continue
+			}
+			name = kebabCase(method.Name)
+		}
+
+		if _, _, err := validateExecuteFunc(rt, method.Func.Interface()); err != nil {
+			panic(fmt.Errorf("%s: method %s: %w", rt, method.Name, err))
+		}
+		messageOptions = append(messageOptions, WithMessage(name, method.Func.Interface()))
+	}
+
+	return WithObject(object, append(messageOptions, options...)...)
+}
+
+// isHandlerMethod returns whether the method looks like a message handler,
+// i.e. it returns []MessageResponse or is a streaming handler.
+func isHandlerMethod(ft reflect.Type) bool {
+	if ft.NumOut() > 0 && ft.Out(0) == messageResponsesType {
+		return true
+	}
+	return ft.NumIn() > 0 && ft.In(ft.NumIn()-1) == emitterType &&
+		ft.NumOut() == 1 && ft.Out(0) == errorType
+}
+
+// kebabCase converts a Go identifier to kebab-case, keeping acronyms together
+// (e.g. ListHTTPRoutes becomes list-http-routes).
+func kebabCase(name string) string {
+	runes := []rune(name)
+	var b strings.Builder
+	for i, r := range runes {
+		if unicode.IsUpper(r) && i > 0 {
+			prevLower := unicode.IsLower(runes[i-1]) || unicode.IsDigit(runes[i-1])
+			nextLower := i+1 < len(runes) && unicode.IsLower(runes[i+1])
+			if prevLower || (unicode.IsUpper(runes[i-1]) && nextLower) {
+				b.WriteByte('-')
+			}
+		}
+		b.WriteRune(unicode.ToLower(r))
+	}
+	return b.String()
+}
@@ -0,0 +1,80 @@
+package prototype_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/aoldershaw/prototype-sdk-go"
+	"github.com/stretchr/testify/require"
+)
+
+type MethodObject struct {
+	Foo string `json:"foo" prototype:"required"`
+}
+
+func (o MethodObject) ListBranches(req OptionalParams) ([]prototype.MessageResponse, error) {
+	return []prototype.MessageResponse{{Object: map[string]interface{}{"branch": req.Baz}}}, nil
+}
+
+func (o MethodObject) CheckHTTPStatus(ctx context.Context) []prototype.MessageResponse {
+	return nil
+}
+
+func (o MethodObject) StreamCommits(emitter prototype.Emitter) error {
+	return nil
+}
+
+func (o MethodObject) Renamed() []prototype.MessageResponse {
+	return nil
+}
+
+func (o MethodObject) Excluded() []prototype.MessageResponse {
+	return nil
+}
+
+func (o MethodObject) Helper() string {
+	return "not a message"
+}
+
+func (o MethodObject) PrototypeMessages() map[string]string {
+	return map[string]string{
+		"Renamed":  "rename",
+		"Excluded": "-",
+	}
+}
+
+type BadMethodObject struct{}
+
+func (BadMethodObject) Broken(a, b, c string) []prototype.MessageResponse {
+	return nil
+}
+
+type UnknownMethodObject struct{}
+
+func (UnknownMethodObject) PrototypeMessages() map[string]string {
+	return map[string]string{"Missing": "missing"}
+}
+
+func TestWithObjectMethods(t *testing.T) {
+	proto := prototype.New(prototype.WithObjectMethods(MethodObject{}))
+
+	info, err := proto.Info(prototype.InfoRequest{Object: map[string]interface{}{"foo": "abc"}})
+	require.NoError(t, err)
+	require.ElementsMatch(t, []string{"list-branches", "check-http-status", "stream-commits", "rename"}, info.Messages)
+
+	response, err := proto.Run("list-branches", prototype.MessageRequest{Object: map[string]interface{}{
+		"foo": "abc",
+		"baz": "main",
+	}})
+	require.NoError(t, err)
+	require.Equal(t, "main", response[0].Object["branch"])
+}
+
+func TestWithObjectMethodsMisconfigured(t *testing.T) {
+	require.Panics(t, func() {
+		prototype.New(prototype.WithObjectMethods(BadMethodObject{}))
+	})
+	require.Panics(t, func() {
+		prototype.New(prototype.WithObjectMethods(UnknownMethodObject{}))
+	})
+}
@@ -0,0 +1,110 @@
+package prototype
+
+import (
+	"context"
+	"fmt"
+	"runtime/debug"
+	"time"
+)
+
+// Invocation describes a message being invoked on a decoded object.
+type Invocation struct {
+	// The name of the message.
+	Message string
+
+	// The decoded object.
+	Object Object
+
+	// The decoded request, or nil if the message does not take a request.
+	Request Request
+}
+
+// Handler handles an Invocation.
+type Handler func(ctx context.Context, invocation Invocation) ([]MessageResponse, error)
+
+// Middleware wraps a Handler, e.g. to add logging, metrics or auth checks
+// around every message.
+type Middleware func(next Handler) Handler
+
+// WithMiddleware wraps every message invocation in the given middleware. The
+// first middleware is the outermost. Prototype-level middleware wraps any
+// object-level middleware (see WithObjectMiddleware).
+func WithMiddleware(middleware ...Middleware) Option {
+	return func(p *Prototype) {
+		p.middleware = append(p.middleware, middleware...)
+	}
+}
+
+// WithObjectMiddleware wraps the invocations of the object's messages
+// (including inherited messages) in the given middleware. The first
+// middleware is the outermost.
+func WithObjectMiddleware(middleware ...Middleware) ObjectOption {
+	return func(o *objectWrapper) {
+		o.middleware = append(o.middleware, middleware...)
+	}
+}
+
+// chain wraps handler in the middleware, such that the first middleware is
+// the outermost.
+func chain(handler Handler, middleware ...[]Middleware) Handler {
+	for i := len(middleware) - 1; i >= 0; i-- {
+		for j := len(middleware[i]) - 1; j >= 0; j-- {
+			handler = middleware[i][j](handler)
+		}
+	}
+	return handler
+}
+
+// Recover is a Middleware that converts a panic in the next handler into a
+// HandlerPanicError, so that outer middleware observe the failure like any
+// other error. Run recovers from panics regardless, so Recover is only needed
+// for the benefit of other middleware.
+func Recover() Middleware {
+	return func(next Handler) Handler {
+		return func(ctx context.Context, invocation Invocation) (responses []MessageResponse, err error) {
+			defer recoverHandlerPanic(&err)
+			return next(ctx, invocation)
+		}
+	}
+}
+
+// Timing is a Middleware that reports how long each invocation took.
+func Timing(report func(invocation Invocation, elapsed time.Duration)) Middleware {
+	return func(next Handler) Handler {
+		return func(ctx context.Context, invocation Invocation) ([]MessageResponse, error) {
+			start := time.Now()
+			defer func() {
+				report(invocation, time.Since(start))
+			}()
+			return next(ctx, invocation)
+		}
+	}
+}
+
+// HandlerPanicError is returned by Run when a message handler (or middleware)
+// panics.
+type HandlerPanicError struct {
+	// The value passed to panic.
+	Value interface{}
+
+	// The stack trace of the goroutine that panicked.
+	Stack []byte
+}
+
+func (e HandlerPanicError) Error() string {
+	return fmt.Sprintf("handler panicked: %v", e.Value)
+}
+
+// Unwrap returns the value passed to panic if it is an error.
+func (e HandlerPanicError) Unwrap() error {
+	err, _ := e.Value.(error)
+	return err
+}
+
+// recoverHandlerPanic must be deferred. It sets *err to a HandlerPanicError
+// upon a panic.
+func recoverHandlerPanic(err *error) {
+	if r := recover(); r != nil {
+		*err = HandlerPanicError{Value: r, Stack: debug.Stack()}
+	}
+}
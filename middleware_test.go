@@ -0,0 +1,94 @@
+package prototype_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/aoldershaw/prototype-sdk-go"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMiddleware(t *testing.T) {
+	var calls []string
+	record := func(name string) prototype.Middleware {
+		return func(next prototype.Handler) prototype.Handler {
+			return func(ctx context.Context, invocation prototype.Invocation) ([]prototype.MessageResponse, error) {
+				calls = append(calls, name+" "+invocation.Message)
+				require.Equal(t, SimpleObject{Foo: "abc"}, invocation.Object)
+				require.Equal(t, OptionalParams{Baz: "def"}, invocation.Request)
+				return next(ctx, invocation)
+			}
+		}
+	}
+
+	proto := prototype.New(
+		prototype.WithMiddleware(record("outer"), record("middle")),
+		prototype.WithObject(SimpleObject{},
+			prototype.WithObjectMiddleware(record("inner")),
+			prototype.WithMessage("msg", func(SimpleObject, OptionalParams) []prototype.MessageResponse {
+				calls = append(calls, "handler")
+				return nil
+			}),
+		))
+
+	_, err := proto.Run("msg", prototype.MessageRequest{Object: map[string]interface{}{
+		"foo": "abc",
+		"baz": "def",
+	}})
+	require.NoError(t, err)
+	require.Equal(t, []string{"outer msg", "middle msg", "inner msg", "handler"}, calls)
+}
+
+func TestRecoverMiddleware(t *testing.T) {
+	var timed []string
+	proto := prototype.New(
+		prototype.WithMiddleware(
+			prototype.Timing(func(invocation prototype.Invocation, elapsed time.Duration) {
+				timed = append(timed, invocation.Message)
+			}),
+			prototype.Recover(),
+		),
+		prototype.WithObject(SimpleObject{},
+			prototype.WithMessage("msg", func(SimpleObject) []prototype.MessageResponse {
+				panic("boom")
+			}),
+		))
+
+	_, err := proto.Run("msg", prototype.MessageRequest{Object: map[string]interface{}{
+		"foo": "abc",
+	}})
+	require.Error(t, err)
+	require.Equal(t, []string{"msg"}, timed)
+
+	protoErr := prototype.AsError(err)
+	require.Equal(t, prototype.ErrorCodeHandlerPanic, protoErr.Code)
+	require.Equal(t, "SimpleObject", protoErr.ObjectType)
+	require.Contains(t, protoErr.Message, "boom")
+}
+
+func TestPrototypeRunRecoversPanics(t *testing.T) {
+	errBoom := errors.New("boom")
+	proto := prototype.New(
+		prototype.WithObject(SimpleObject{},
+			prototype.WithMessage("msg", func(SimpleObject) []prototype.MessageResponse {
+				panic(errBoom)
+			}),
+		))
+
+	_, err := proto.Run("msg", prototype.MessageRequest{Object: map[string]interface{}{
+		"foo": "abc",
+	}})
+
+	var panicErr prototype.HandlerPanicError
+	require.ErrorAs(t, err, &panicErr)
+	require.Equal(t, errBoom, panicErr.Value)
+	require.Contains(t, string(panicErr.Stack), "TestPrototypeRunRecoversPanics")
+	require.ErrorIs(t, err, errBoom)
+
+	protoErr := prototype.AsError(err)
+	require.Equal(t, prototype.ErrorCodeHandlerPanic, protoErr.Code)
+	require.Equal(t, "SimpleObject", protoErr.ObjectType)
+	require.Equal(t, 6, prototype.ExitCode(err))
+}
@@ -1,6 +1,7 @@
 package prototype
 
 import (
+	"context"
 	"fmt"
 	"reflect"
 )
@@ -18,33 +19,189 @@ type Object interface{}
 type Request interface{}
 
 type objectWrapper struct {
-	object   Object
-	messages []message
+	object      Object
+	description string
+	priority    int
+	messages    []message
+
+	inherit    bool
+	hidden     map[string]bool
+	middleware []Middleware
+}
+
+func (o objectWrapper) supports(msg string) bool {
+	for _, m := range o.messages {
+		if m.name == msg {
+			return true
+		}
+	}
+	return false
 }
 
 type invokableMessage struct {
 	msg     message
 	object  Object
 	request Request
+
+	// requiredKeys is the number of keys that the object or the request
+	// require to be set. Since every non-empty key of the payload must be
+	// used by a candidate, the number of keys that candidates use can only
+	// differ on empty keys, so they are ranked by how constrained they are
+	// instead (see Run).
+	requiredKeys int
+	priority     int
+	middleware   []Middleware
 }
 
-func (i invokableMessage) invoke() ([]MessageResponse, error) {
-	return i.msg.execute(i.object, i.request)
+// invoke executes the message, wrapped in the given middleware and then the
+// object's middleware. Panics are converted into a HandlerPanicError, and the
+// artifacts in the responses are verified to exist.
+func (i invokableMessage) invoke(ctx context.Context, middleware []Middleware) (responses []MessageResponse, err error) {
+	defer recoverHandlerPanic(&err)
+
+	handler := func(ctx context.Context, invocation Invocation) ([]MessageResponse, error) {
+		dir := workingDir(ctx)
+		if emitter, ok := ctx.Value(emitterKey{}).(Emitter); ok {
+			ctx = context.WithValue(ctx, emitterKey{}, EmitterFunc(func(response MessageResponse) error {
+				if err := verifyArtifacts(dir, response); err != nil {
+					return err
+				}
+				return emitter.Emit(response)
+			}))
+		}
+		responses, err := i.msg.execute(ctx, invocation.Object, invocation.Request)
+		if err != nil {
+			return nil, err
+		}
+		if err := verifyArtifacts(dir, responses...); err != nil {
+			return nil, err
+		}
+		return responses, nil
+	}
+	return chain(handler, middleware, i.middleware)(ctx, Invocation{
+		Message: i.msg.name,
+		Object:  i.object,
+		Request: i.request,
+	})
 }
 
 func (i invokableMessage) name() string {
 	return i.msg.name
 }
 
+func (i invokableMessage) info() MessageInfo {
+	info := MessageInfo{
+		Name:              i.msg.name,
+		Description:       i.msg.description,
+		ProducesArtifacts: i.msg.producesArtifacts,
+		SideEffects:       i.msg.sideEffects,
+	}
+	if i.msg.requestType != nil {
+		info.RequestSchema = schemaForType(i.msg.requestType)
+	}
+	if i.msg.outputType != nil {
+		info.OutputSchema = schemaForType(i.msg.outputType)
+		if containsType(i.msg.outputType, artifactType) {
+			info.ProducesArtifacts = true
+		}
+	}
+	return info
+}
+
 type ObjectOption func(*objectWrapper)
 
 type message struct {
 	name        string
 	requestType reflect.Type
-	execute     func(Object, Request) ([]MessageResponse, error)
+	execute     func(context.Context, Object, Request) ([]MessageResponse, error)
+
+	description       string
+	outputType        reflect.Type
+	producesArtifacts bool
+	sideEffects       bool
+}
+
+// MessageOption configures a message registered with WithMessage or one of the
+// typed alternatives (e.g. Message).
+type MessageOption func(*message)
+
+// WithPriority sets the priority of the object, which is used to resolve
+// ambiguity between objects that require the same number of keys (see
+// Prototype.Run). Objects with a higher priority are preferred.
+// The default priority is 0.
+func WithPriority(priority int) ObjectOption {
+	return func(o *objectWrapper) {
+		o.priority = priority
+	}
+}
+
+// WithDescription describes the object to users.
+func WithDescription(description string) ObjectOption {
+	return func(o *objectWrapper) {
+		o.description = description
+	}
+}
+
+// WithMessageDescription describes the message to users.
+func WithMessageDescription(description string) MessageOption {
+	return func(m *message) {
+		m.description = description
+	}
+}
+
+// WithOutputObject declares the type of the objects returned by the message.
+// If the type contains an Artifact, the message is assumed to produce
+// artifacts.
+func WithOutputObject(object Object) MessageOption {
+	return func(m *message) {
+		m.outputType = reflect.TypeOf(object)
+	}
+}
+
+// WithArtifacts declares that the message produces artifacts.
+func WithArtifacts() MessageOption {
+	return func(m *message) {
+		m.producesArtifacts = true
+	}
+}
+
+// WithSideEffects declares that the message mutates external state (e.g.
+// pushing a commit), rather than only reading it.
+func WithSideEffects() MessageOption {
+	return func(m *message) {
+		m.sideEffects = true
+	}
 }
 
+// WithObject registers an object type (given by the type of object) along with
+// its messages.
+//
+// Objects (and requests) are decoded from the payload using encoding/json.
+// Their fields may be further constrained with `prototype` struct tags, e.g.
+// `prototype:"required,min=1"`, and given defaults with
+// `prototype:"default=..."` or by implementing Defaulter. The supported tag
+// options are:
+//
+//   - required - the field must not be the zero value
+//   - nonempty - the string, slice or map must not be empty
+//   - min=N, max=N - bounds on the value of a number, or the length of a
+//     string, slice or map
+//   - len=N - the exact length of a string, slice or map
+//   - oneof=a|b|c - the value must be one of the given values
+//   - url - the string must be an absolute URL
+//   - semver - the string must be a semantic version (optionally prefixed by v)
+//   - duration - the string must be parseable by time.ParseDuration
+//   - pattern=REGEXP - the string must match the regular expression
+//   - file, dir - the Artifact must be a regular file or a directory,
+//     respectively. Input artifacts must exist regardless
+//   - default=VALUE - the value of the field if it is unset. Strings are used
+//     verbatim, durations are parsed by time.ParseDuration, and anything else
+//     is parsed as JSON
+//
+// A payload that fails to decode or validate does not satisfy the object.
+// WithObject panics if the tags are invalid.
 func WithObject(object Object, options ...ObjectOption) Option {
+	mustValidateTags(reflect.TypeOf(object))
 	return func(p *Prototype) {
 		wrapper := objectWrapper{object: object}
 		for _, opt := range options {
@@ -66,7 +223,23 @@ func WithObject(object Object, options ...ObjectOption) Option {
 //
 // ...where ConcreteObject must match the Object the message is for, and
 // ConcreteRequest may be any type.
-func WithMessage(name string, executeFunc interface{}) ObjectOption {
+//
+// Alternatively, a streaming handler takes a prototype.Emitter as its last
+// argument and returns only an error, e.g.
+// func(ConcreteObject, ConcreteRequest, prototype.Emitter) error. Each
+// response is passed to Emit as it is produced, and Execute writes it to the
+// `response_path` immediately (see RunEmit).
+//
+// Each signature may also take a context.Context either as its first argument
+// or immediately after ConcreteObject, e.g.
+// func(context.Context, ConcreteObject, ConcreteRequest) or
+// func(ConcreteObject, context.Context) - the latter allows methods to accept
+// a context as their first argument. The context is canceled when the message
+// should be aborted (see WithGracePeriod).
+//
+// The signature is checked when the option is applied, and WithMessage panics
+// if it is invalid. See ObjectOf and Message for a type-safe alternative.
+func WithMessage(name string, executeFunc interface{}, options ...MessageOption) ObjectOption {
 	return func(o *objectWrapper) {
 		objectType := reflect.TypeOf(o.object)
 
@@ -75,38 +248,85 @@ func WithMessage(name string, executeFunc interface{}) ObjectOption {
 			panic(err)
 		}
 
-		o.messages = append(o.messages, message{
-			name:        name,
-			requestType: requestType,
-			execute:     execute,
-		})
+		o.messages = append(o.messages, newMessage(name, requestType, execute, options))
 	}
 }
 
-func validateExecuteFunc(objectType reflect.Type, executeFunc interface{}) (func(Object, Request) ([]MessageResponse, error), reflect.Type, error) {
+func newMessage(name string, requestType reflect.Type, execute func(context.Context, Object, Request) ([]MessageResponse, error), options []MessageOption) message {
+	mustValidateTags(requestType)
+	m := message{
+		name:        name,
+		requestType: requestType,
+		execute:     execute,
+	}
+	for _, opt := range options {
+		opt(&m)
+	}
+	return m
+}
+
+var (
+	contextType = reflect.TypeOf((*context.Context)(nil)).Elem()
+	errorType   = reflect.TypeOf((*error)(nil)).Elem()
+)
+
+func validateExecuteFunc(objectType reflect.Type, executeFunc interface{}) (func(context.Context, Object, Request) ([]MessageResponse, error), reflect.Type, error) {
 	rt := reflect.TypeOf(executeFunc)
-	if (rt.NumIn() != 1 && rt.NumIn() != 2) ||
-		!objectType.AssignableTo(rt.In(0)) {
-		return nil, nil, fmt.Errorf("the function must have 1 or 2 arguments (%s, and optionally a request type)", objectType)
+
+	// the context may either be the first argument, or immediately follow the
+	// object (so that methods can accept it as their first argument)
+	var in []reflect.Type
+	ctxIndex := -1
+	for i := 0; i < rt.NumIn(); i++ {
+		if rt.In(i) == contextType && ctxIndex == -1 && i <= 1 {
+			ctxIndex = i
+			continue
+		}
+		in = append(in, rt.In(i))
 	}
-	if (rt.NumOut() != 1 && rt.NumOut() != 2) ||
+	// streaming handlers take an Emitter as their last argument
+	streamingFunc := len(in) > 1 && in[len(in)-1] == emitterType
+	if streamingFunc {
+		in = in[:len(in)-1]
+	}
+	if (len(in) != 1 && len(in) != 2) ||
+		!objectType.AssignableTo(in[0]) {
+		return nil, nil, fmt.Errorf("the function must have 1 or 2 arguments (%s, and optionally a request type), optionally with a context.Context before or after %s and a prototype.Emitter last", objectType, objectType)
+	}
+	if streamingFunc {
+		if rt.NumOut() != 1 || rt.Out(0) != errorType {
+			return nil, nil, fmt.Errorf("a function taking a prototype.Emitter must return only an error")
+		}
+	} else if (rt.NumOut() != 1 && rt.NumOut() != 2) ||
 		!reflect.TypeOf([]MessageResponse(nil)).AssignableTo(rt.Out(0)) {
 		return nil, nil, fmt.Errorf("the function must have 1 or 2 return types ([]prototype.MessageResponse, and optionally, error)")
 	}
 	var requestType reflect.Type
-	if rt.NumIn() == 2 {
-		requestType = rt.In(1)
+	if len(in) == 2 {
+		requestType = in[1]
 	}
 
-	return func(object Object, request Request) ([]MessageResponse, error) {
-		var args []reflect.Value
-		if rt.NumIn() == 1 {
-			args = []reflect.Value{reflect.ValueOf(object)}
-		} else {
-			args = []reflect.Value{reflect.ValueOf(object), reflect.ValueOf(request)}
+	args := func(ctx context.Context, object Object, request Request) []reflect.Value {
+		args := []reflect.Value{reflect.ValueOf(object)}
+		if len(in) == 2 {
+			args = append(args, reflect.ValueOf(request))
+		}
+		if ctxIndex != -1 {
+			args = append(args[:ctxIndex], append([]reflect.Value{reflect.ValueOf(&ctx).Elem()}, args[ctxIndex:]...)...)
 		}
+		return args
+	}
+
+	if streamingFunc {
+		return streaming(func(ctx context.Context, object Object, request Request, emitter Emitter) error {
+			result := reflect.ValueOf(executeFunc).Call(append(args(ctx, object, request), reflect.ValueOf(&emitter).Elem()))
+			err, _ := result[0].Interface().(error)
+			return err
+		}), requestType, nil
+	}
 
-		result := reflect.ValueOf(executeFunc).Call(args)
+	return func(ctx context.Context, object Object, request Request) ([]MessageResponse, error) {
+		result := reflect.ValueOf(executeFunc).Call(args(ctx, object, request))
 
 		response := result[0].Interface().([]MessageResponse)
 		var err error
@@ -117,10 +337,10 @@ func validateExecuteFunc(objectType reflect.Type, executeFunc interface{}) (func
 	}, requestType, nil
 }
 
-func invoke(object objectWrapper, msg string, request interface{}) ([]MessageResponse, error) {
+func invoke(ctx context.Context, object objectWrapper, msg string, request interface{}) ([]MessageResponse, error) {
 	for _, m := range object.messages {
 		if m.name == msg {
-			return m.execute(object.object, request)
+			return m.execute(ctx, object.object, request)
 		}
 	}
 	return nil, unsupportedMessageError{msg: msg, object: object.object}
@@ -1,28 +1,52 @@
 package prototype
 
 import (
-	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
+	"io"
 	"os"
-	"path/filepath"
+	"os/signal"
 	"reflect"
+	"sort"
+	"syscall"
+	"time"
 )
 
 const InterfaceVersion = "1.0"
 
+// DetailedInfoInterfaceVersion is the interface version reported by prototypes
+// that opt in to detailed info (see WithDetailedInfo). In addition to the
+// names of the messages, the InfoResponse includes MessageDetails.
+const DetailedInfoInterfaceVersion = "1.1"
+
+// DefaultGracePeriod is how long Execute waits for a message handler to return
+// after its context is canceled by a signal before exiting the process.
+const DefaultGracePeriod = 10 * time.Second
+
 type Prototype struct {
-	objects []objectWrapper
-	Icon    string
+	objects      []objectWrapper
+	Icon         string
+	debug        bool
+	gracePeriod  time.Duration
+	detailedInfo bool
+	strict       bool
+	middleware   []Middleware
+	serverSocket string
+
+	artifactDigests bool
 }
 
 type Option func(*Prototype)
 
 func New(options ...Option) Prototype {
-	p := Prototype{}
+	p := Prototype{gracePeriod: DefaultGracePeriod}
 	for _, opt := range options {
 		opt(&p)
 	}
+	p.inheritMessages()
 	return p
 }
 
@@ -32,104 +56,411 @@ func WithIcon(icon string) Option {
 	}
 }
 
+// WithDetailedInfo makes Info respond with DetailedInfoInterfaceVersion and
+// include MessageDetails. It should only be used with versions of Concourse
+// that support this interface version.
+func WithDetailedInfo() Option {
+	return func(p *Prototype) {
+		p.detailedInfo = true
+	}
+}
+
+// WithStrictMatching makes Run fail whenever multiple objects satisfy a
+// payload, rather than resolving the ambiguity (see Run).
+func WithStrictMatching() Option {
+	return func(p *Prototype) {
+		p.strict = true
+	}
+}
+
+// WithDebug enables debug mode for Execute.
+func WithDebug() Option {
+	return func(p *Prototype) {
+		p.debug = true
+	}
+}
+
+// WithGracePeriod configures how long Execute waits for a message handler to
+// return after receiving SIGINT or SIGTERM before exiting the process.
+func WithGracePeriod(gracePeriod time.Duration) Option {
+	return func(p *Prototype) {
+		p.gracePeriod = gracePeriod
+	}
+}
+
+// Execute handles a single request from Concourse. The message to run is read
+// from the first command line argument (if there is none, an InfoRequest is
+// handled), and the request is read from stdin.
+//
+// Upon receiving SIGINT or SIGTERM, the context passed to the message handler
+// is canceled. If the handler does not return within the grace period (see
+// WithGracePeriod), the process exits with the exit code for
+// ErrorCodeCanceled.
+//
+// If a server socket is configured (see WithServerSocket), the request is
+// forwarded to the server rather than being handled in process.
+//
+// If debug mode is enabled (see WithDebug), or the PROTOTYPE_DEBUG environment
+// variable is set, a report of why each candidate object and message was
+// rejected is written to stderr.
+//
+// Responses are written to the `response_path` as they are produced (see
+// Emitter). If the request fails, an ErrorResponse is written to the
+// `response_path` (if it could be determined) and an *Error is returned. If
+// responses were already written, the ErrorResponse follows them and is
+// marked as Partial. ExitCode can be used to determine the exit code for the
+// process.
+//
+// If the first argument is --validate, Execute instead reports any issues
+// with the definition of the prototype to stdout (see Validate).
+//
+// If the first argument is --docs, Execute instead writes reference
+// documentation for the prototype to stdout (see GenerateDocs). The format may
+// be configured with --format=markdown (the default) or --format=html.
+//
+// If the first argument is --batch, Execute instead runs a stream of
+// BatchRequests read from stdin, writing BatchResponses to stdout (see
+// RunBatch). The number of requests run in parallel may be configured with
+// --workers=N.
 func (p Prototype) Execute() error {
-	var responsePath string
-	var encode func(*json.Encoder) error
-	if len(os.Args) > 1 {
-		var request struct {
-			MessageRequest
-			ResponsePath string `json:"response_path"`
-		}
-		if err := json.NewDecoder(os.Stdin).Decode(&request); err != nil {
-			return fmt.Errorf("invalid json request: %w", err)
-		}
-		responsePath = request.ResponsePath
+	return p.ExecuteEnv(Environment{})
+}
 
-		message := os.Args[1]
-		responses, err := p.Run(message, request.MessageRequest)
-		if err != nil {
-			return fmt.Errorf("run %q: %w", message, err)
-		}
-		encode = func(encoder *json.Encoder) error {
-			for _, response := range responses {
-				if err := encoder.Encode(response); err != nil {
-					return err
-				}
-			}
-			return nil
+// ExecuteEnv is like Execute, but operates in the given Environment rather
+// than that of the process.
+func (p Prototype) ExecuteEnv(env Environment) error {
+	env = env.withDefaults()
+	if len(env.Args) > 0 {
+		switch env.Args[0] {
+		case "--batch":
+			return p.executeBatch(env)
+		case "--validate":
+			return p.executeValidate(env)
+		case "--docs":
+			return p.executeDocs(env)
 		}
-	} else {
-		var request struct {
-			InfoRequest
+	}
+
+	var request struct {
+		Object       map[string]interface{} `json:"object"`
+		ResponsePath string                 `json:"response_path"`
+	}
+	payload, err := io.ReadAll(env.Stdin)
+	if err != nil {
+		return &Error{Code: ErrorCodeInvalidRequest, Message: fmt.Sprintf("read request: %s", err), err: err}
+	}
+	if err := json.Unmarshal(payload, &request); err != nil {
+		// try to salvage the response_path so that the failure can still be
+		// reported there
+		var dst struct {
 			ResponsePath string `json:"response_path"`
 		}
-		if err := json.NewDecoder(os.Stdin).Decode(&request); err != nil {
-			return fmt.Errorf("invalid json request: %w", err)
+		json.Unmarshal(payload, &dst)
+		protoErr := &Error{Code: ErrorCodeInvalidRequest, Message: fmt.Sprintf("invalid json request: %s", err), err: err}
+		return env.writeResponse(dst.ResponsePath, func(*json.Encoder) error { return protoErr })
+	}
+
+	var message string
+	if len(env.Args) > 0 {
+		message = env.Args[0]
+	}
+	if p.debug || env.Getenv("PROTOTYPE_DEBUG") != "" {
+		if rejections, err := p.diagnose(env.Dir, message, request.Object); err == nil {
+			writeDiagnostics(env.Stderr, message, rejections)
 		}
-		responsePath = request.ResponsePath
+	}
+
+	ctx, stop := p.cancelOnSignal(env.context(), env.Stderr)
+	defer stop()
 
-		response, err := p.Info(request.InfoRequest)
-		if err != nil {
-			return fmt.Errorf("info: %w", err)
+	return env.writeResponse(request.ResponsePath, func(encoder *json.Encoder) error {
+		if socketPath := p.socketPath(env); socketPath != "" {
+			err := NewClient(socketPath).forward(ctx, message, request.Object, encoder)
+			var unavailableErr serverUnavailableError
+			if !errors.As(err, &unavailableErr) {
+				return err
+			}
+			fmt.Fprintf(env.Stderr, "prototype: %s, handling request in process\n", unavailableErr)
 		}
-		encode = func(encoder *json.Encoder) error {
-			return encoder.Encode(response)
+		return p.respond(ctx, message, request.Object, encoder, env.Stderr)
+	})
+}
+
+// respond handles a request, writing the responses to encoder. If message is
+// empty, an InfoRequest is handled.
+// Diagnostics are written to stderr.
+func (p Prototype) respond(ctx context.Context, message string, object map[string]interface{}, encoder *json.Encoder, stderr io.Writer) error {
+	if message != "" {
+		emitter := &encoderEmitter{encoder: encoder, digests: p.artifactDigests, dir: workingDir(ctx)}
+		if err := p.runRecovered(ctx, message, MessageRequest{Object: object}, emitter, stderr); err != nil {
+			protoErr := AsError(fmt.Errorf("run %q: %w", message, err))
+			protoErr.Partial = emitter.emitted > 0
+			return protoErr
 		}
+		return nil
 	}
 
-	responseFile, err := os.OpenFile(responsePath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	response, err := p.InfoContext(ctx, InfoRequest{Object: object})
 	if err != nil {
-		return fmt.Errorf("open response file: %w", err)
+		return fmt.Errorf("info: %w", err)
+	}
+	if err := encoder.Encode(response); err != nil {
+		return &Error{Code: ErrorCodeInternal, Message: fmt.Sprintf("write response: %s", err), err: err}
 	}
-	defer responseFile.Close()
+	return nil
+}
 
-	encoder := json.NewEncoder(responseFile)
-	if err := encode(encoder); err != nil {
-		return fmt.Errorf("write response: %w", err)
+// executeBatch runs Execute in batch mode.
+func (p Prototype) executeBatch(env Environment) error {
+	flags := flag.NewFlagSet("batch", flag.ContinueOnError)
+	flags.SetOutput(env.Stderr)
+	workers := flags.Int("workers", 1, "number of requests to run in parallel")
+	if err := flags.Parse(env.Args[1:]); err != nil {
+		return &Error{Code: ErrorCodeInvalidRequest, Message: err.Error(), err: err}
 	}
 
+	ctx, stop := p.cancelOnSignal(env.context(), env.Stderr)
+	defer stop()
+
+	return p.RunBatch(ctx, env.Stdin, env.Stdout, WithBatchWorkers(*workers))
+}
+
+// executeValidate runs Execute in validate mode.
+func (p Prototype) executeValidate(env Environment) error {
+	err := p.Validate()
+	var definitionErr DefinitionError
+	if !errors.As(err, &definitionErr) {
+		return err
+	}
+	for _, issue := range definitionErr.Issues {
+		fmt.Fprintln(env.Stdout, issue)
+	}
+	return &Error{
+		Code:    ErrorCodeInvalidDefinition,
+		Message: fmt.Sprintf("prototype definition has %d issue(s)", len(definitionErr.Issues)),
+		err:     err,
+	}
+}
+
+// executeDocs runs Execute in docs mode.
+func (p Prototype) executeDocs(env Environment) error {
+	flags := flag.NewFlagSet("docs", flag.ContinueOnError)
+	flags.SetOutput(env.Stderr)
+	format := flags.String("format", string(DocsMarkdown), "format of the documentation (markdown or html)")
+	if err := flags.Parse(env.Args[1:]); err != nil {
+		return &Error{Code: ErrorCodeInvalidRequest, Message: err.Error(), err: err}
+	}
+	switch DocsFormat(*format) {
+	case DocsMarkdown, DocsHTML:
+	default:
+		return &Error{Code: ErrorCodeInvalidRequest, Message: fmt.Sprintf("unsupported docs format %q", *format)}
+	}
+	if err := p.GenerateDocs(env.Stdout, DocsFormat(*format)); err != nil {
+		return &Error{Code: ErrorCodeInternal, Message: fmt.Sprintf("write docs: %s", err), err: err}
+	}
 	return nil
 }
 
+// Main runs Execute, reports any failure to stderr, and exits the process
+// with the corresponding exit code (see ErrorCode.ExitCode).
+func (p Prototype) Main() {
+	err := p.Execute()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+	}
+	os.Exit(ExitCode(err))
+}
+
+// cancelOnSignal returns a context that is canceled upon receiving SIGINT or
+// SIGTERM. If stop is not called within the grace period after the signal,
+// the process exits. Progress is reported to stderr.
+func (p Prototype) cancelOnSignal(parent context.Context, stderr io.Writer) (ctx context.Context, stop func()) {
+	ctx, cancel := context.WithCancel(parent)
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+
+	done := make(chan struct{})
+	go func() {
+		select {
+		case sig := <-signals:
+			fmt.Fprintf(stderr, "prototype: received %s, canceling\n", sig)
+			cancel()
+		case <-done:
+			return
+		}
+		select {
+		case <-time.After(p.gracePeriod):
+			fmt.Fprintf(stderr, "prototype: message did not return within %s of being canceled, exiting\n", p.gracePeriod)
+			os.Exit(ErrorCodeCanceled.ExitCode())
+		case <-done:
+		}
+	}()
+
+	return ctx, func() {
+		signal.Stop(signals)
+		close(done)
+		cancel()
+	}
+}
+
+// runRecovered calls RunEmit. Since RunEmit recovers from panics in handlers,
+// any panic here is a bug in the SDK, and is converted into an internal
+// *Error. The stack trace of a HandlerPanicError is written to stderr.
+func (p Prototype) runRecovered(ctx context.Context, message string, request MessageRequest, emitter Emitter, stderr io.Writer) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = &Error{Code: ErrorCodeInternal, Message: fmt.Sprintf("panic: %v", r)}
+		}
+	}()
+	err = p.RunEmit(ctx, message, request, emitter)
+	var panicErr HandlerPanicError
+	if errors.As(err, &panicErr) {
+		fmt.Fprintf(stderr, "%s\n%s", panicErr, panicErr.Stack)
+	}
+	return err
+}
+
+// writeStream calls encode with an encoder for w. If encode fails, an
+// ErrorResponse is written and the failure is returned as an *Error.
+func writeStream(w io.Writer, encode func(*json.Encoder) error) error {
+	encoder := json.NewEncoder(w)
+	protoErr := AsError(encode(encoder))
+	if protoErr == nil {
+		return nil
+	}
+	if err := encoder.Encode(ErrorResponse{Error: protoErr}); err != nil {
+		return &Error{Code: ErrorCodeInternal, Message: fmt.Sprintf("write error response: %s", err), err: err}
+	}
+	return protoErr
+}
+
+// Run invokes the message on the object in the request.
+//
+// The object is decoded as each registered object type. A type satisfies the
+// payload if it decodes and validates successfully, supports the message, the
+// message's request decodes and validates from the remaining keys, and no
+// non-empty keys are left over.
+//
+// If multiple types satisfy the payload, the most specific candidate is
+// preferred, i.e. the one whose object and request require the most keys
+// (with the required or nonempty options), since each of them was satisfied
+// by the payload. Among candidates that require as many keys, the one with
+// the highest priority (see WithPriority) is preferred. If there is still a
+// tie, the object is ambiguous and an error is returned. In strict mode (see
+// WithStrictMatching), any ambiguity results in an error.
+//
+// If the payload contains artifacts with digests (see WithArtifactDigests),
+// they are verified once the object has been resolved.
 func (p Prototype) Run(message string, request MessageRequest) ([]MessageResponse, error) {
-	invocations, err := decodePossibleInvocations(request.Object, p.objects, message)
+	return p.RunContext(context.Background(), message, request)
+}
+
+// RunContext is like Run, but passes ctx to message handlers that accept a
+// context.Context.
+func (p Prototype) RunContext(ctx context.Context, message string, request MessageRequest) ([]MessageResponse, error) {
+	dir := workingDir(ctx)
+	invocations, rejections, err := decodePossibleInvocations(dir, request.Object, p.objects, message)
 	if err != nil {
 		return nil, err
 	}
 	if len(invocations) == 0 {
-		return nil, fmt.Errorf("no object satisfied payload")
+		return nil, NoMatchError{Message: message, Rejections: rejections}
+	}
+	invocation, err := p.resolve(invocations)
+	if err != nil {
+		return nil, err
+	}
+	if err := verifyArtifactDigests(dir, invocation, request.Object); err != nil {
+		return nil, err
+	}
+
+	responses, err := invocation.invoke(ctx, p.middleware)
+	if err != nil {
+		return nil, handlerError{objectType: reflect.TypeOf(invocation.object), err: err}
 	}
-	if len(invocations) > 1 {
+	return responses, nil
+}
+
+// resolve picks the invocation to use when multiple objects satisfy a payload
+// for the same message (see Run).
+func (p Prototype) resolve(invocations []invokableMessage) (invokableMessage, error) {
+	if len(invocations) == 1 {
+		return invocations[0], nil
+	}
+	ambiguous := func(candidates []invokableMessage) error {
 		var satisfiableTypes []reflect.Type
-		for _, invocation := range invocations {
+		for _, invocation := range candidates {
 			satisfiableTypes = append(satisfiableTypes, reflect.TypeOf(invocation.object))
 		}
-		return nil, fmt.Errorf("object is ambiguous - satisfies types %v", satisfiableTypes)
+		return ambiguousError{types: satisfiableTypes}
+	}
+	if p.strict {
+		return invokableMessage{}, ambiguous(invocations)
 	}
 
-	responses, err := invocations[0].invoke()
-	if err != nil {
-		return nil, fmt.Errorf("invoke: %w", err)
+	ranked := make([]invokableMessage, len(invocations))
+	copy(ranked, invocations)
+	sort.SliceStable(ranked, func(i, j int) bool {
+		if ranked[i].requiredKeys != ranked[j].requiredKeys {
+			return ranked[i].requiredKeys > ranked[j].requiredKeys
+		}
+		return ranked[i].priority > ranked[j].priority
+	})
+	best := ranked[0]
+	var tied []invokableMessage
+	for _, invocation := range ranked {
+		if invocation.requiredKeys == best.requiredKeys && invocation.priority == best.priority {
+			tied = append(tied, invocation)
+		}
 	}
-	return responses, nil
+	if len(tied) > 1 {
+		return invokableMessage{}, ambiguous(tied)
+	}
+	return best, nil
 }
 
 func (p Prototype) Info(request InfoRequest) (InfoResponse, error) {
-	invocations, err := decodePossibleInvocations(request.Object, p.objects, "")
+	return p.InfoContext(context.Background(), request)
+}
+
+// InfoContext is like Info, but resolves input artifacts against the working
+// directory of ctx (see WorkingDir).
+func (p Prototype) InfoContext(ctx context.Context, request InfoRequest) (InfoResponse, error) {
+	invocations, _, err := decodePossibleInvocations(workingDir(ctx), request.Object, p.objects, "")
 	if err != nil {
 		return InfoResponse{}, err
 	}
 
-	messages := make([]string, len(invocations))
-	for i, invocation := range invocations {
-		messages[i] = invocation.name()
+	// a message may be satisfied by multiple objects, so group by name and
+	// resolve each message as Run would
+	names := []string{}
+	byName := map[string][]invokableMessage{}
+	for _, invocation := range invocations {
+		name := invocation.name()
+		if _, ok := byName[name]; !ok {
+			names = append(names, name)
+		}
+		byName[name] = append(byName[name], invocation)
 	}
 
-	return InfoResponse{
+	response := InfoResponse{
 		InterfaceVersion: InterfaceVersion,
 		Icon:             p.Icon,
-		Messages:         messages,
-	}, nil
+		Messages:         names,
+	}
+	if p.detailedInfo {
+		response.InterfaceVersion = DetailedInfoInterfaceVersion
+		response.MessageDetails = make([]MessageInfo, len(names))
+		for i, name := range names {
+			invocation, err := p.resolve(byName[name])
+			if err != nil {
+				// the message is ambiguous, but is still supported
+				invocation = byName[name][0]
+			}
+			response.MessageDetails[i] = invocation.info()
+		}
+	}
+	return response, nil
 }
 
 // InfoRequest is the payload written to stdin for the default CMD.
@@ -152,6 +483,31 @@ type InfoResponse struct {
 
 	// The messages supported by the object.
 	Messages []string `json:"messages"`
+
+	// Details about each of the messages supported by the object. Only set
+	// for DetailedInfoInterfaceVersion.
+	MessageDetails []MessageInfo `json:"message_details,omitempty"`
+}
+
+// MessageInfo describes a message in an InfoResponse.
+type MessageInfo struct {
+	// The name of the message.
+	Name string `json:"name"`
+
+	// A description of the message.
+	Description string `json:"description,omitempty"`
+
+	// The schema of the message's request, if it takes one.
+	RequestSchema *Schema `json:"request_schema,omitempty"`
+
+	// The schema of the objects returned by the message, if known.
+	OutputSchema *Schema `json:"output_schema,omitempty"`
+
+	// Whether the message produces artifacts.
+	ProducesArtifacts bool `json:"produces_artifacts"`
+
+	// Whether the message mutates external state.
+	SideEffects bool `json:"side_effects"`
 }
 
 // MessageRequest is the payload written to stdin for a message.
@@ -172,31 +528,6 @@ type MessageResponse struct {
 	Metadata []MetadataField `json:"metadata,omitempty"`
 }
 
-// Artifact is a relative path relative to the working directory. It cannot go
-// up a directory (i.e. must be within the working directory or any child
-// directories of the working directory). If emitted in the Object of the
-// MessageResponse, Artifacts may be used in pipelines as inputs to other
-// prototypes/tasks/resources.
-type Artifact string
-
-func (a Artifact) MarshalJSON() ([]byte, error) {
-	path := filepath.Clean(string(a))
-	return json.Marshal(map[string]string{"artifact": path})
-}
-
-func (a *Artifact) UnmarshalJSON(payload []byte) error {
-	var dst struct {
-		Artifact string `json:"artifact"`
-	}
-	dec := json.NewDecoder(bytes.NewReader(payload))
-	dec.DisallowUnknownFields()
-	if err := dec.Decode(&dst); err != nil {
-		return err
-	}
-	*a = Artifact(dst.Artifact)
-	return nil
-}
-
 // MetadataField represents a named bit of metadata associated to an object.
 type MetadataField struct {
 	Name  string `json:"name"`
@@ -1,7 +1,9 @@
 package prototype_test
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"testing"
 
@@ -18,6 +20,18 @@ type SimpleParams struct {
 	Baz string `json:"baz" prototype:"required"`
 }
 
+type OptionalParams struct {
+	Baz string `json:"baz"`
+}
+
+type FooObject struct {
+	Foo string `json:"foo"`
+}
+
+type RequiredFooObject struct {
+	Foo string `json:"foo" prototype:"required"`
+}
+
 type CustomUnmarshal struct {
 	PowerOfTen int `json:"power_of_ten"`
 }
@@ -172,3 +186,378 @@ func TestPrototypeRun(t *testing.T) {
 	require.NoError(t, err)
 	require.Equal(t, expectedResponse, response)
 }
+
+func TestPrototypeRunErrors(t *testing.T) {
+	for _, tt := range []struct {
+		desc          string
+		prototype     prototype.Prototype
+		object        map[string]interface{}
+		expectedError prototype.Error
+	}{
+		{
+			desc: "missing required field",
+			prototype: prototype.New(
+				prototype.WithObject(SimpleObject{},
+					prototype.WithMessage("msg", noop),
+				)),
+			object: map[string]interface{}{
+				"bar": 123,
+			},
+			expectedError: prototype.Error{
+				Code:       prototype.ErrorCodeNoMatch,
+				ObjectType: "SimpleObject",
+				Field:      "foo",
+			},
+		},
+		{
+			desc: "ambiguous",
+			prototype: prototype.New(
+				prototype.WithObject(SimpleObject{},
+					prototype.WithMessage("msg", noop),
+				),
+				prototype.WithObject(RequiredFooObject{},
+					prototype.WithMessage("msg", noop),
+				)),
+			object: map[string]interface{}{
+				"foo": "abc",
+			},
+			expectedError: prototype.Error{
+				Code: prototype.ErrorCodeAmbiguous,
+			},
+		},
+		{
+			desc: "handler error",
+			prototype: prototype.New(
+				prototype.WithObject(SimpleObject{},
+					prototype.WithMessage("msg", func(SimpleObject) ([]prototype.MessageResponse, error) {
+						return nil, prototype.Retryable(errors.New("oops"))
+					}),
+				)),
+			object: map[string]interface{}{
+				"foo": "abc",
+			},
+			expectedError: prototype.Error{
+				Code:       prototype.ErrorCodeHandler,
+				ObjectType: "SimpleObject",
+				Retryable:  true,
+			},
+		},
+	} {
+		t.Run(tt.desc, func(t *testing.T) {
+			_, err := tt.prototype.Run("msg", prototype.MessageRequest{Object: tt.object})
+			require.Error(t, err)
+
+			protoErr := prototype.AsError(err)
+			require.Equal(t, tt.expectedError.Code, protoErr.Code)
+			require.Equal(t, tt.expectedError.ObjectType, protoErr.ObjectType)
+			require.Equal(t, tt.expectedError.Field, protoErr.Field)
+			require.Equal(t, tt.expectedError.Retryable, protoErr.Retryable)
+			require.Equal(t, tt.expectedError.Code.ExitCode(), prototype.ExitCode(err))
+		})
+	}
+}
+
+type NestedObject struct {
+	Inner struct {
+		Items []SimpleParams `json:"items"`
+	} `json:"inner"`
+}
+
+func TestPrototypeDiagnose(t *testing.T) {
+	proto := prototype.New(
+		prototype.WithObject(SimpleObject{},
+			prototype.WithMessage("msg1", noop),
+			prototype.WithMessage("msg2", func(_ SimpleObject, _ SimpleParams) []prototype.MessageResponse {
+				return nil
+			}),
+		),
+		prototype.WithObject(NestedObject{},
+			prototype.WithMessage("msg1", noop),
+		),
+		prototype.WithObject(CustomUnmarshal{},
+			prototype.WithMessage("other", noop),
+		),
+	)
+
+	rejections, err := proto.Diagnose("msg1", map[string]interface{}{
+		"foo":   "abc",
+		"extra": "def",
+		"inner": map[string]interface{}{
+			"items": []interface{}{
+				map[string]interface{}{"baz": "set"},
+				map[string]interface{}{},
+			},
+		},
+	})
+	require.NoError(t, err)
+	require.Len(t, rejections, 3)
+
+	require.Equal(t, "SimpleObject", rejections[0].ObjectType)
+	require.Equal(t, "msg1", rejections[0].Message)
+	require.Equal(t, []string{"extra", "inner"}, rejections[0].UnusedKeys)
+
+	require.Equal(t, "NestedObject", rejections[1].ObjectType)
+	require.Empty(t, rejections[1].Message)
+	require.Equal(t, "inner.items[1].baz", rejections[1].Field)
+
+	require.Equal(t, "CustomUnmarshal", rejections[2].ObjectType)
+	require.Contains(t, rejections[2].Reason.Error(), "not supported")
+
+	_, err = proto.Run("msg1", prototype.MessageRequest{Object: map[string]interface{}{
+		"foo": 123,
+	}})
+	var noMatchErr prototype.NoMatchError
+	require.ErrorAs(t, err, &noMatchErr)
+	require.Len(t, noMatchErr.Rejections, 3)
+}
+
+func TestPrototypeRunContext(t *testing.T) {
+	proto := prototype.New(
+		prototype.WithObject(SimpleObject{},
+			prototype.WithMessage("msg", func(ctx context.Context, object SimpleObject, params SimpleParams) ([]prototype.MessageResponse, error) {
+				require.Equal(t, "baz", params.Baz)
+				<-ctx.Done()
+				return nil, ctx.Err()
+			}),
+		))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err := proto.RunContext(ctx, "msg", prototype.MessageRequest{
+		Object: map[string]interface{}{
+			"foo": "foo",
+			"baz": "baz",
+		},
+	})
+	require.ErrorIs(t, err, context.Canceled)
+
+	protoErr := prototype.AsError(err)
+	require.Equal(t, prototype.ErrorCodeCanceled, protoErr.Code)
+	require.True(t, protoErr.Retryable)
+}
+
+func TestPrototypeRunContextAfterObject(t *testing.T) {
+	proto := prototype.New(
+		prototype.WithObject(SimpleObject{},
+			prototype.WithMessage("msg", func(object SimpleObject, ctx context.Context) []prototype.MessageResponse {
+				require.Equal(t, "value", ctx.Value(ctxKey{}))
+				return nil
+			}),
+		))
+
+	ctx := context.WithValue(context.Background(), ctxKey{}, "value")
+	_, err := proto.RunContext(ctx, "msg", prototype.MessageRequest{
+		Object: map[string]interface{}{"foo": "foo"},
+	})
+	require.NoError(t, err)
+}
+
+type ctxKey struct{}
+
+func TestPrototypeTypedMessages(t *testing.T) {
+	expectedObject := SimpleObject{Foo: "foo", Bar: 123}
+	expectedParams := SimpleParams{Baz: "baz"}
+
+	proto := prototype.New(
+		prototype.ObjectOf[SimpleObject](
+			prototype.Message("msg1", func(object SimpleObject, _ prototype.NoRequest) ([]prototype.MessageResponse, error) {
+				return []prototype.MessageResponse{{Object: map[string]interface{}{"msg": "msg1"}}}, nil
+			}),
+			prototype.MessageContext("msg2", func(_ context.Context, object SimpleObject, params SimpleParams) ([]prototype.MessageResponse, error) {
+				require.Equal(t, expectedObject, object)
+				require.Equal(t, expectedParams, params)
+				return []prototype.MessageResponse{{Object: map[string]interface{}{"msg": "msg2"}}}, nil
+			}),
+		))
+
+	info, err := proto.Info(prototype.InfoRequest{Object: map[string]interface{}{"foo": "foo"}})
+	require.NoError(t, err)
+	require.ElementsMatch(t, []string{"msg1"}, info.Messages)
+
+	response, err := proto.Run("msg2", prototype.MessageRequest{
+		Object: map[string]interface{}{
+			"foo": expectedObject.Foo,
+			"bar": expectedObject.Bar,
+			"baz": expectedParams.Baz,
+		},
+	})
+	require.NoError(t, err)
+	require.Equal(t, []prototype.MessageResponse{{Object: map[string]interface{}{"msg": "msg2"}}}, response)
+}
+
+func TestPrototypeDetailedInfo(t *testing.T) {
+	object := map[string]interface{}{"foo": "blah"}
+	options := []prototype.Option{
+		prototype.WithObject(SimpleObject{},
+			prototype.WithMessage("msg1", noop,
+				prototype.WithMessageDescription("does a thing"),
+				prototype.WithOutputObject(BuildOutput{}),
+			),
+			prototype.WithMessage("msg2", func(_ SimpleObject, _ FooObject) []prototype.MessageResponse {
+				return nil
+			}, prototype.WithSideEffects()),
+		),
+	}
+
+	response, err := prototype.New(options...).Info(prototype.InfoRequest{Object: object})
+	require.NoError(t, err)
+	require.Equal(t, prototype.InterfaceVersion, response.InterfaceVersion)
+	require.Empty(t, response.MessageDetails)
+
+	response, err = prototype.New(append(options, prototype.WithDetailedInfo())...).Info(prototype.InfoRequest{Object: object})
+	require.NoError(t, err)
+	require.Equal(t, prototype.DetailedInfoInterfaceVersion, response.InterfaceVersion)
+	require.Len(t, response.MessageDetails, 2)
+
+	msg1 := response.MessageDetails[0]
+	require.Equal(t, "msg1", msg1.Name)
+	require.Equal(t, "does a thing", msg1.Description)
+	require.Nil(t, msg1.RequestSchema)
+	require.Equal(t, "BuildOutput", msg1.OutputSchema.Title)
+	require.True(t, msg1.ProducesArtifacts)
+	require.False(t, msg1.SideEffects)
+
+	msg2 := response.MessageDetails[1]
+	require.Equal(t, "msg2", msg2.Name)
+	require.Equal(t, "FooObject", msg2.RequestSchema.Title)
+	require.False(t, msg2.ProducesArtifacts)
+	require.True(t, msg2.SideEffects)
+}
+
+func TestPrototypeRunAmbiguity(t *testing.T) {
+	respondWith := func(name string) func(interface{}) []prototype.MessageResponse {
+		return func(interface{}) []prototype.MessageResponse {
+			return []prototype.MessageResponse{{Object: map[string]interface{}{"handler": name}}}
+		}
+	}
+
+	type Repository struct {
+		URI        string `json:"uri" prototype:"required"`
+		PrivateKey string `json:"private_key"`
+	}
+	type ListBranchesRequest struct {
+		// only lists the branch with this name
+		Branch string `json:"branch"`
+	}
+	type Branch struct {
+		Repository
+		Branch string `json:"branch" prototype:"required"`
+	}
+	type FetchRequest struct {
+		Ref string `json:"ref" prototype:"required"`
+	}
+	type Checkout struct {
+		Repository
+		Ref string `json:"ref"`
+	}
+	type Mirror struct {
+		Repository
+		Upstream string `json:"upstream"`
+	}
+	listBranches := func(Repository, ListBranchesRequest) []prototype.MessageResponse {
+		return respondWith("repository")(nil)
+	}
+	fetch := func(Repository, FetchRequest) []prototype.MessageResponse {
+		return respondWith("repository")(nil)
+	}
+
+	for _, tt := range []struct {
+		desc            string
+		prototype       prototype.Prototype
+		object          map[string]interface{}
+		expectedHandler string
+		expectAmbiguous bool
+	}{
+		{
+			desc: "most required keys wins",
+			prototype: prototype.New(
+				prototype.WithObject(Repository{},
+					prototype.WithMessage("msg", listBranches),
+				),
+				prototype.WithObject(Branch{},
+					prototype.WithMessage("msg", respondWith("branch")),
+				)),
+			object: map[string]interface{}{
+				"uri":    "https://example.com/repo.git",
+				"branch": "main",
+			},
+			expectedHandler: "branch",
+		},
+		{
+			desc: "required keys include the request",
+			prototype: prototype.New(
+				prototype.WithObject(Checkout{},
+					prototype.WithMessage("msg", respondWith("checkout")),
+				),
+				prototype.WithObject(Repository{},
+					prototype.WithMessage("msg", fetch),
+				)),
+			object: map[string]interface{}{
+				"uri": "https://example.com/repo.git",
+				"ref": "abcdef",
+			},
+			expectedHandler: "repository",
+		},
+		{
+			desc: "priority breaks ties",
+			prototype: prototype.New(
+				prototype.WithObject(Repository{},
+					prototype.WithMessage("msg", respondWith("repository")),
+				),
+				prototype.WithObject(Mirror{},
+					prototype.WithPriority(1),
+					prototype.WithMessage("msg", respondWith("mirror")),
+				)),
+			object: map[string]interface{}{
+				"uri": "https://example.com/repo.git",
+			},
+			expectedHandler: "mirror",
+		},
+		{
+			desc: "tie is ambiguous",
+			prototype: prototype.New(
+				prototype.WithObject(Repository{},
+					prototype.WithMessage("msg", respondWith("repository")),
+				),
+				prototype.WithObject(Mirror{},
+					prototype.WithMessage("msg", respondWith("mirror")),
+				)),
+			object: map[string]interface{}{
+				"uri": "https://example.com/repo.git",
+			},
+			expectAmbiguous: true,
+		},
+		{
+			desc: "strict mode",
+			prototype: prototype.New(
+				prototype.WithObject(Repository{},
+					prototype.WithMessage("msg", listBranches),
+				),
+				prototype.WithObject(Branch{},
+					prototype.WithPriority(1),
+					prototype.WithMessage("msg", respondWith("branch")),
+				),
+				prototype.WithStrictMatching()),
+			object: map[string]interface{}{
+				"uri":    "https://example.com/repo.git",
+				"branch": "main",
+			},
+			expectAmbiguous: true,
+		},
+	} {
+		t.Run(tt.desc, func(t *testing.T) {
+			info, err := tt.prototype.Info(prototype.InfoRequest{Object: tt.object})
+			require.NoError(t, err)
+			require.Equal(t, []string{"msg"}, info.Messages)
+
+			response, err := tt.prototype.Run("msg", prototype.MessageRequest{Object: tt.object})
+			if tt.expectAmbiguous {
+				require.Equal(t, prototype.ErrorCodeAmbiguous, prototype.AsError(err).Code)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tt.expectedHandler, response[0].Object["handler"])
+		})
+	}
+}
@@ -0,0 +1,131 @@
+package prototypetest
+
+import (
+	"encoding/json"
+	"flag"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/aoldershaw/prototype-sdk-go"
+	"github.com/stretchr/testify/require"
+)
+
+var update = flag.Bool("prototypetest.update", false, "update the golden files of prototypetest.Golden")
+
+// GoldenRequest is the request fixture of a Golden test case, read from
+// request.json.
+type GoldenRequest struct {
+	// The message to run. If empty, an InfoRequest is made.
+	Message string `json:"message,omitempty"`
+
+	// The object to act on.
+	Object map[string]interface{} `json:"object"`
+}
+
+// goldenResponse is the outcome of a Golden test case, stored in
+// response.json.
+type goldenResponse struct {
+	ExitCode  int                         `json:"exit_code"`
+	Info      *prototype.InfoResponse     `json:"info,omitempty"`
+	Responses []prototype.MessageResponse `json:"responses,omitempty"`
+	Error     *prototype.Error            `json:"error,omitempty"`
+}
+
+// Golden runs each test case in dir against the prototype, and compares the
+// outcome to the golden file of the test case. Each subdirectory of dir
+// containing a request.json (see GoldenRequest) is a test case, whose golden
+// file is response.json. If the test case has a files directory, its contents
+// are copied into the working directory (e.g. for input artifacts).
+//
+// Running the tests with the -prototypetest.update flag writes the golden
+// files rather than comparing them. The flag is namespaced so that it does not
+// conflict with an -update flag defined by the tests themselves.
+func Golden(t *testing.T, proto prototype.Prototype, dir string) {
+	t.Helper()
+	var cases []string
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() && d.Name() == "request.json" {
+			cases = append(cases, filepath.Dir(path))
+		}
+		return nil
+	})
+	require.NoError(t, err)
+	require.NotEmpty(t, cases, "no test cases found in %s", dir)
+
+	for _, caseDir := range cases {
+		caseDir := caseDir
+		name, err := filepath.Rel(dir, caseDir)
+		require.NoError(t, err)
+		t.Run(filepath.ToSlash(name), func(t *testing.T) {
+			runGolden(t, proto, caseDir)
+		})
+	}
+}
+
+func runGolden(t *testing.T, proto prototype.Prototype, caseDir string) {
+	payload, err := os.ReadFile(filepath.Join(caseDir, "request.json"))
+	require.NoError(t, err)
+	var request GoldenRequest
+	require.NoError(t, json.Unmarshal(payload, &request), "invalid request.json")
+
+	h := New(t, proto)
+	if files := filepath.Join(caseDir, "files"); isDir(files) {
+		require.NoError(t, copyDir(files, h.Dir()))
+	}
+
+	var result Result
+	if request.Message == "" {
+		result = h.Info(request.Object)
+	} else {
+		result = h.Run(request.Message, request.Object)
+	}
+	actual, err := json.MarshalIndent(goldenResponse{
+		ExitCode:  result.ExitCode,
+		Info:      result.Info,
+		Responses: result.Responses,
+		Error:     result.Error,
+	}, "", "  ")
+	require.NoError(t, err)
+	actual = append(actual, '\n')
+
+	goldenPath := filepath.Join(caseDir, "response.json")
+	if *update {
+		require.NoError(t, os.WriteFile(goldenPath, actual, 0644))
+		return
+	}
+	expected, err := os.ReadFile(goldenPath)
+	require.NoError(t, err, "missing golden file - run the tests with -prototypetest.update to create it")
+	require.JSONEq(t, string(expected), string(actual), "run the tests with -prototypetest.update to update the golden file")
+}
+
+func isDir(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && info.IsDir()
+}
+
+// copyDir copies the contents of src into dst.
+func copyDir(src, dst string) error {
+	return filepath.WalkDir(src, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dst, rel)
+		if d.IsDir() {
+			return os.MkdirAll(target, 0755)
+		}
+		contents, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		return os.WriteFile(target, contents, 0644)
+	})
+}
@@ -0,0 +1,11 @@
+package prototypetest_test
+
+import (
+	"testing"
+
+	"github.com/aoldershaw/prototype-sdk-go/prototypetest"
+)
+
+func TestGolden(t *testing.T) {
+	prototypetest.Golden(t, testPrototype(), "testdata/golden")
+}
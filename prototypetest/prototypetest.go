@@ -0,0 +1,113 @@
+// Package prototypetest provides a harness for testing prototypes end-to-end,
+// by running Execute in process as Concourse would run the prototype.
+package prototypetest
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/aoldershaw/prototype-sdk-go"
+	"github.com/stretchr/testify/require"
+)
+
+// Harness runs a Prototype against a temporary working directory.
+//
+// The working directory is passed to Execute through its Environment (see
+// Environment.Dir), so harnesses may be used in parallel. Handlers should
+// resolve artifacts against the context they are given (see WorkingDir).
+type Harness struct {
+	t     testing.TB
+	proto prototype.Prototype
+	dir   string
+	env   map[string]string
+}
+
+// New returns a Harness for the prototype, with a new temporary working
+// directory.
+func New(t testing.TB, proto prototype.Prototype) *Harness {
+	return &Harness{
+		t:     t,
+		proto: proto,
+		dir:   t.TempDir(),
+		env:   map[string]string{},
+	}
+}
+
+// Dir returns the working directory that the prototype is run in.
+func (h *Harness) Dir() string {
+	return h.dir
+}
+
+// Setenv sets an environment variable for the prototype.
+func (h *Harness) Setenv(key, value string) {
+	h.env[key] = value
+}
+
+// WriteFile writes a file (e.g. an input artifact) to the working directory,
+// creating any missing parent directories.
+func (h *Harness) WriteFile(path string, contents string) {
+	h.t.Helper()
+	path = filepath.Join(h.dir, path)
+	require.NoError(h.t, os.MkdirAll(filepath.Dir(path), 0755))
+	require.NoError(h.t, os.WriteFile(path, []byte(contents), 0644))
+}
+
+// Info runs the prototype with no message, as Concourse does to discover the
+// messages supported by an object.
+func (h *Harness) Info(object map[string]interface{}) Result {
+	h.t.Helper()
+	return h.Execute(nil, object)
+}
+
+// Run runs the message on the object.
+func (h *Harness) Run(message string, object map[string]interface{}) Result {
+	h.t.Helper()
+	return h.Execute([]string{message}, object)
+}
+
+// Execute runs the prototype with the given command line arguments, passing a
+// request for the object on stdin.
+func (h *Harness) Execute(args []string, object map[string]interface{}) Result {
+	h.t.Helper()
+	responsePath := filepath.Join(h.t.TempDir(), "response.json")
+	request, err := json.Marshal(map[string]interface{}{
+		"object":        object,
+		"response_path": responsePath,
+	})
+	require.NoError(h.t, err)
+
+	result := h.execute(args, request)
+	response, err := os.ReadFile(responsePath)
+	if !os.IsNotExist(err) {
+		require.NoError(h.t, err)
+	}
+	result.Response = response
+	result.decode(h.t, len(args) == 0)
+	return result
+}
+
+func (h *Harness) execute(args []string, stdin []byte) Result {
+	h.t.Helper()
+	if args == nil {
+		args = []string{}
+	}
+	var stdout, stderr bytes.Buffer
+	err := h.proto.ExecuteEnv(prototype.Environment{
+		Args:   args,
+		Stdin:  bytes.NewReader(stdin),
+		Stdout: &stdout,
+		Stderr: &stderr,
+		Getenv: func(key string) string { return h.env[key] },
+		Dir:    h.dir,
+	})
+
+	return Result{
+		Err:      err,
+		ExitCode: prototype.ExitCode(err),
+		Stdout:   stdout.String(),
+		Stderr:   stderr.String(),
+	}
+}
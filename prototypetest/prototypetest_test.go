@@ -0,0 +1,160 @@
+package prototypetest_test
+
+import (
+	"context"
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/aoldershaw/prototype-sdk-go"
+	"github.com/aoldershaw/prototype-sdk-go/prototypetest"
+	"github.com/stretchr/testify/require"
+)
+
+type Repository struct {
+	URI string `json:"uri" prototype:"required"`
+}
+
+type Build struct {
+	Context prototype.Artifact `json:"context" prototype:"required,dir"`
+}
+
+func testPrototype() prototype.Prototype {
+	return prototype.New(
+		prototype.WithIcon("mdi:git"),
+		prototype.WithObject(Repository{},
+			prototype.WithMessage("list", func(repo Repository, emitter prototype.Emitter) error {
+				for _, branch := range []string{"main", "dev"} {
+					if err := emitter.Emit(prototype.MessageResponse{Object: map[string]interface{}{"branch": branch}}); err != nil {
+						return err
+					}
+				}
+				return errors.New("connection reset")
+			}),
+			prototype.WithMessage("panic", func(Repository) []prototype.MessageResponse {
+				panic("boom")
+			}),
+		),
+		prototype.WithObject(Build{},
+			prototype.WithMessage("build", func(ctx context.Context, build Build) ([]prototype.MessageResponse, error) {
+				image, err := prototype.NewArtifactDir(ctx, "image")
+				if err != nil {
+					return nil, err
+				}
+				return []prototype.MessageResponse{{Object: map[string]interface{}{"image": image}}}, nil
+			}),
+		),
+	)
+}
+
+func TestHarness(t *testing.T) {
+	h := prototypetest.New(t, testPrototype())
+
+	t.Run("info", func(t *testing.T) {
+		result := h.Info(map[string]interface{}{"uri": "https://example.com"})
+		result.RequireSuccess(t)
+		result.RequireMessages(t, "list", "panic")
+		require.Equal(t, "mdi:git", result.Info.Icon)
+	})
+
+	t.Run("partial failure", func(t *testing.T) {
+		result := h.Run("list", map[string]interface{}{"uri": "https://example.com"})
+		result.RequireError(t, prototype.ErrorCodeHandler)
+		result.RequireObjects(t,
+			map[string]interface{}{"branch": "main"},
+			map[string]interface{}{"branch": "dev"},
+		)
+		require.True(t, result.Error.Partial)
+		require.Equal(t, "Repository", result.Error.ObjectType)
+	})
+
+	t.Run("panic", func(t *testing.T) {
+		result := h.Run("panic", map[string]interface{}{"uri": "https://example.com"})
+		result.RequireError(t, prototype.ErrorCodeHandlerPanic)
+		require.False(t, result.Error.Partial)
+		require.Contains(t, result.Stderr, "handler panicked: boom")
+	})
+
+	t.Run("artifacts", func(t *testing.T) {
+		result := h.Run("build", map[string]interface{}{"context": map[string]interface{}{"artifact": "src"}})
+		result.RequireError(t, prototype.ErrorCodeNoMatch)
+		require.Equal(t, "context", result.Error.Field)
+
+		h.WriteFile("src/Dockerfile", "FROM scratch")
+		result = h.Run("build", map[string]interface{}{"context": map[string]interface{}{"artifact": "src"}})
+		result.RequireSuccess(t)
+		result.RequireObjects(t, map[string]interface{}{"image": map[string]interface{}{"artifact": "image"}})
+		require.DirExists(t, filepath.Join(h.Dir(), "image"))
+	})
+
+	t.Run("debug", func(t *testing.T) {
+		h.Setenv("PROTOTYPE_DEBUG", "1")
+		defer h.Setenv("PROTOTYPE_DEBUG", "")
+		result := h.Run("build", map[string]interface{}{"uri": "https://example.com"})
+		result.RequireError(t, prototype.ErrorCodeNoMatch)
+		require.Contains(t, result.Stderr, "Build")
+	})
+}
+
+func TestHarnessServer(t *testing.T) {
+	socketDir, err := os.MkdirTemp("", "proto")
+	require.NoError(t, err)
+	defer os.RemoveAll(socketDir)
+	socketPath := filepath.Join(socketDir, "server.sock")
+
+	var served []string
+	server := prototype.New(
+		prototype.WithMiddleware(func(next prototype.Handler) prototype.Handler {
+			return func(ctx context.Context, invocation prototype.Invocation) ([]prototype.MessageResponse, error) {
+				served = append(served, invocation.Message)
+				return next(ctx, invocation)
+			}
+		}),
+		prototype.WithObject(Repository{},
+			prototype.WithMessage("list", func(Repository) []prototype.MessageResponse {
+				return []prototype.MessageResponse{{Object: map[string]interface{}{"branch": "main"}}}
+			}),
+		),
+		prototype.WithObject(Build{},
+			prototype.WithMessage("build", func(ctx context.Context, build Build) ([]prototype.MessageResponse, error) {
+				if _, err := os.Stat(filepath.Join(build.Context.Path(ctx), "Dockerfile")); err != nil {
+					return nil, err
+				}
+				image, err := prototype.NewArtifactDir(ctx, "server-image")
+				if err != nil {
+					return nil, err
+				}
+				return []prototype.MessageResponse{{Object: map[string]interface{}{"image": image}}}, nil
+			}),
+		),
+	)
+	h := prototypetest.New(t, testPrototype())
+	h.Setenv(prototype.ServerSocketEnv, socketPath)
+
+	// falls back to handling the request in process
+	result := h.Run("list", map[string]interface{}{"uri": "https://example.com"})
+	result.RequireError(t, prototype.ErrorCodeHandler)
+	require.Contains(t, result.Stderr, "server unavailable")
+
+	listener, err := net.Listen("unix", socketPath)
+	require.NoError(t, err)
+	defer listener.Close()
+	go server.Serve(listener)
+
+	result = h.Run("list", map[string]interface{}{"uri": "https://example.com"})
+	result.RequireSuccess(t)
+	result.RequireObjects(t, map[string]interface{}{"branch": "main"})
+	require.Equal(t, []string{"list"}, served)
+
+	// artifacts are resolved against the working directory of the client,
+	// rather than that of the server
+	h.WriteFile("src/Dockerfile", "FROM scratch")
+	result = h.Run("build", map[string]interface{}{"context": map[string]interface{}{"artifact": "src"}})
+	result.RequireSuccess(t)
+	result.RequireObjects(t, map[string]interface{}{"image": map[string]interface{}{"artifact": "server-image"}})
+	require.Equal(t, []string{"list", "build"}, served)
+	require.DirExists(t, filepath.Join(h.Dir(), "server-image"))
+	require.NoDirExists(t, "server-image")
+}
@@ -0,0 +1,106 @@
+package prototypetest
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"testing"
+
+	"github.com/aoldershaw/prototype-sdk-go"
+	"github.com/stretchr/testify/require"
+)
+
+// Result is the outcome of running a prototype with a Harness.
+type Result struct {
+	// The error returned by Execute.
+	Err error
+
+	// The exit code of the process (see prototype.ExitCode).
+	ExitCode int
+
+	// What Execute wrote to the stdout and stderr of its Environment. Output
+	// that handlers write to the stdout and stderr of the process is not
+	// captured.
+	Stdout string
+	Stderr string
+
+	// The raw contents of the `response_path`.
+	Response []byte
+
+	// The decoded InfoResponse, if no message was run.
+	Info *prototype.InfoResponse
+
+	// The decoded MessageResponses.
+	Responses []prototype.MessageResponse
+
+	// The decoded ErrorResponse, if one was written.
+	Error *prototype.Error
+}
+
+func (r *Result) decode(t testing.TB, info bool) {
+	t.Helper()
+	decoder := json.NewDecoder(bytes.NewReader(r.Response))
+	for {
+		var payload json.RawMessage
+		err := decoder.Decode(&payload)
+		if err == io.EOF {
+			return
+		}
+		require.NoError(t, err, "invalid response stream")
+
+		var errResponse prototype.ErrorResponse
+		if json.Unmarshal(payload, &errResponse) == nil && errResponse.Error != nil {
+			r.Error = errResponse.Error
+			continue
+		}
+		if info {
+			r.Info = &prototype.InfoResponse{}
+			require.NoError(t, json.Unmarshal(payload, r.Info))
+			continue
+		}
+		var response prototype.MessageResponse
+		require.NoError(t, json.Unmarshal(payload, &response))
+		r.Responses = append(r.Responses, response)
+	}
+}
+
+// RequireSuccess fails the test if the prototype failed.
+func (r Result) RequireSuccess(t testing.TB) {
+	t.Helper()
+	require.NoError(t, r.Err, "stderr:\n%s", r.Stderr)
+	require.Nil(t, r.Error)
+	require.Equal(t, 0, r.ExitCode)
+}
+
+// RequireError fails the test unless the prototype failed with the given
+// error code, and wrote a corresponding ErrorResponse.
+func (r Result) RequireError(t testing.TB, code prototype.ErrorCode) {
+	t.Helper()
+	require.Error(t, r.Err)
+	require.Equal(t, code.ExitCode(), r.ExitCode)
+	require.NotNil(t, r.Error, "no ErrorResponse was written")
+	require.Equal(t, code, r.Error.Code, "message: %s", r.Error.Message)
+}
+
+// RequireMessages fails the test unless the InfoResponse lists exactly the
+// given messages (in any order).
+func (r Result) RequireMessages(t testing.TB, messages ...string) {
+	t.Helper()
+	require.NotNil(t, r.Info, "no InfoResponse was written")
+	require.ElementsMatch(t, messages, r.Info.Messages)
+}
+
+// RequireObjects fails the test unless the objects of the responses are
+// equivalent to the given objects, compared as JSON.
+func (r Result) RequireObjects(t testing.TB, objects ...map[string]interface{}) {
+	t.Helper()
+	actual := make([]map[string]interface{}, len(r.Responses))
+	for i, response := range r.Responses {
+		actual[i] = response.Object
+	}
+	expected, err := json.Marshal(objects)
+	require.NoError(t, err)
+	actualJSON, err := json.Marshal(actual)
+	require.NoError(t, err)
+	require.JSONEq(t, string(expected), string(actualJSON))
+}
@@ -0,0 +1,369 @@
+package prototype
+
+import (
+	"encoding"
+	"encoding/json"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SchemaDialect is the JSON Schema dialect of generated schemas.
+const SchemaDialect = "https://json-schema.org/draft/2020-12/schema"
+
+// Schema is a JSON Schema (draft 2020-12). Only the keywords that can be
+// derived from Go types and struct tags are supported.
+type Schema struct {
+	Schema      string      `json:"$schema,omitempty"`
+	Title       string      `json:"title,omitempty"`
+	Description string      `json:"description,omitempty"`
+	Default     interface{} `json:"default,omitempty"`
+
+	Type            string `json:"type,omitempty"`
+	Format          string `json:"format,omitempty"`
+	ContentEncoding string `json:"contentEncoding,omitempty"`
+
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	AdditionalProperties *Schema            `json:"additionalProperties,omitempty"`
+
+	Items *Schema `json:"items,omitempty"`
+
+	Enum          []interface{} `json:"enum,omitempty"`
+	Minimum       *float64      `json:"minimum,omitempty"`
+	Maximum       *float64      `json:"maximum,omitempty"`
+	MinLength     *int          `json:"minLength,omitempty"`
+	MaxLength     *int          `json:"maxLength,omitempty"`
+	MinItems      *int          `json:"minItems,omitempty"`
+	MaxItems      *int          `json:"maxItems,omitempty"`
+	MinProperties *int          `json:"minProperties,omitempty"`
+	MaxProperties *int          `json:"maxProperties,omitempty"`
+	Pattern       string        `json:"pattern,omitempty"`
+
+	Not *Schema `json:"not,omitempty"`
+}
+
+// ObjectSchema describes a registered object and the requests of its
+// messages.
+type ObjectSchema struct {
+	// The name of the object type.
+	Name string `json:"name"`
+
+	// The schema of the object.
+	Schema *Schema `json:"schema"`
+
+	// The schemas of the object's messages.
+	Messages []MessageSchema `json:"messages,omitempty"`
+}
+
+// MessageSchema describes the request of a message.
+type MessageSchema struct {
+	// The name of the message.
+	Name string `json:"name"`
+
+	// A description of the message.
+	Description string `json:"description,omitempty"`
+
+	// The schema of the request. Nil if the message does not take a request.
+	Request *Schema `json:"request,omitempty"`
+
+	// The schema of the objects returned by the message, if known.
+	Output *Schema `json:"output,omitempty"`
+}
+
+// Schemas returns the schema of every registered object and the requests of
+// its messages.
+func (p Prototype) Schemas() []ObjectSchema {
+	schemas := make([]ObjectSchema, len(p.objects))
+	for i, wrapper := range p.objects {
+		rt := reflect.TypeOf(wrapper.object)
+		schemas[i] = ObjectSchema{
+			Name:   rt.Name(),
+			Schema: schemaForType(rt),
+		}
+		schemas[i].Schema.Description = wrapper.description
+		for _, msg := range wrapper.messages {
+			msgSchema := MessageSchema{Name: msg.name, Description: msg.description}
+			if msg.requestType != nil {
+				msgSchema.Request = schemaForType(msg.requestType)
+			}
+			if msg.outputType != nil {
+				msgSchema.Output = schemaForType(msg.outputType)
+			}
+			schemas[i].Messages = append(schemas[i].Messages, msgSchema)
+		}
+	}
+	return schemas
+}
+
+// SchemaOf derives the schema of the Go type of v, which is typically an
+// Object or a Request.
+//
+// Struct fields are named according to their `json` tags, and the fields of
+// embedded structs are promoted as they are by encoding/json. Fields are
+// optional (regardless of omitempty) unless tagged `prototype:"required"`, and
+// the other validation options of the `prototype` tag are reflected in the
+// schema where JSON Schema has an equivalent keyword. Defaults (from `default`
+// tag options and Defaulter) are included in the schema.
+func SchemaOf(v interface{}) *Schema {
+	return schemaForType(reflect.TypeOf(v))
+}
+
+func schemaForType(rt reflect.Type) *Schema {
+	s := (&schemaBuilder{visiting: map[reflect.Type]bool{}}).build(rt)
+	s.Schema = SchemaDialect
+	s.Title = rt.Name()
+	return s
+}
+
+var (
+	artifactType        = reflect.TypeOf(Artifact(""))
+	timeType            = reflect.TypeOf(time.Time{})
+	jsonMarshalerType   = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+	jsonUnmarshalerType = reflect.TypeOf((*json.Unmarshaler)(nil)).Elem()
+	textMarshalerType   = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+)
+
+type schemaBuilder struct {
+	// visiting is used to avoid infinitely recursing into recursive types.
+	visiting map[reflect.Type]bool
+}
+
+func (b *schemaBuilder) build(rt reflect.Type) *Schema {
+	for rt.Kind() == reflect.Ptr {
+		rt = rt.Elem()
+	}
+
+	switch {
+	case rt == artifactType:
+		return &Schema{
+			Type: "object",
+			Properties: map[string]*Schema{
+				"artifact": {Type: "string"},
+				"digest":   {Type: "string", Pattern: "^sha256:[0-9a-f]{64}$"},
+			},
+			Required: []string{"artifact"},
+			// equivalent to false - no other properties are allowed
+			AdditionalProperties: &Schema{Not: &Schema{}},
+		}
+	case rt == timeType:
+		return &Schema{Type: "string", Format: "date-time"}
+	case implements(rt, jsonMarshalerType) || implements(rt, jsonUnmarshalerType):
+		// custom encodings can't be described
+		return &Schema{}
+	case implements(rt, textMarshalerType):
+		return &Schema{Type: "string"}
+	}
+
+	switch rt.Kind() {
+	case reflect.Bool:
+		return &Schema{Type: "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return &Schema{Type: "integer"}
+	case reflect.Float32, reflect.Float64:
+		return &Schema{Type: "number"}
+	case reflect.String:
+		return &Schema{Type: "string"}
+	case reflect.Slice, reflect.Array:
+		if rt.Elem().Kind() == reflect.Uint8 && rt.Kind() == reflect.Slice {
+			return &Schema{Type: "string", ContentEncoding: "base64"}
+		}
+		return &Schema{Type: "array", Items: b.build(rt.Elem())}
+	case reflect.Map:
+		return &Schema{Type: "object", AdditionalProperties: b.build(rt.Elem())}
+	case reflect.Struct:
+		if b.visiting[rt] {
+			return &Schema{Type: "object"}
+		}
+		b.visiting[rt] = true
+		defer delete(b.visiting, rt)
+		return b.buildStruct(rt)
+	default:
+		// interfaces may hold anything
+		return &Schema{}
+	}
+}
+
+func (b *schemaBuilder) buildStruct(rt reflect.Type) *Schema {
+	s := &Schema{Type: "object", Properties: map[string]*Schema{}}
+	defaults := defaultInstance(rt)
+	for _, field := range jsonFields(rt) {
+		fieldSchema := b.build(field.Type)
+		if field.stringOpt {
+			fieldSchema = &Schema{Type: "string"}
+		}
+		if fv, err := defaults.FieldByIndexErr(field.Index); err == nil && !fv.IsZero() {
+			fieldSchema.Default = fv.Interface()
+		}
+		tag, _ := parseFieldTag(field.StructField)
+		applyFieldTag(fieldSchema, tag)
+		s.Properties[field.name] = fieldSchema
+		if tag.required {
+			s.Required = append(s.Required, field.name)
+		}
+	}
+	return s
+}
+
+// applyFieldTag adds the keywords equivalent to the validation options of the
+// tag to the schema.
+func applyFieldTag(s *Schema, tag fieldTag) {
+	// bounds apply to the value of numbers and the size of everything else
+	minSize, maxSize := &s.MinLength, &s.MaxLength
+	switch s.Type {
+	case "integer", "number":
+		s.Minimum, s.Maximum = tag.min, tag.max
+		minSize, maxSize = nil, nil
+	case "array":
+		minSize, maxSize = &s.MinItems, &s.MaxItems
+	case "object":
+		minSize, maxSize = &s.MinProperties, &s.MaxProperties
+	}
+	if minSize != nil {
+		if tag.min != nil {
+			*minSize = intPtr(int(*tag.min))
+		}
+		if tag.max != nil {
+			*maxSize = intPtr(int(*tag.max))
+		}
+		if tag.nonempty && *minSize == nil {
+			*minSize = intPtr(1)
+		}
+		if tag.length != nil {
+			*minSize, *maxSize = intPtr(*tag.length), intPtr(*tag.length)
+		}
+	}
+
+	for _, value := range tag.oneof {
+		if s.Type == "integer" || s.Type == "number" {
+			if n, err := strconv.ParseFloat(value, 64); err == nil {
+				s.Enum = append(s.Enum, n)
+				continue
+			}
+		}
+		s.Enum = append(s.Enum, value)
+	}
+
+	switch {
+	case tag.pattern != nil:
+		s.Pattern = tag.pattern.String()
+	case tag.semver:
+		s.Pattern = semverRegexp.String()
+	}
+	if tag.url {
+		s.Format = "uri"
+	}
+}
+
+func intPtr(i int) *int {
+	return &i
+}
+
+// containsType returns whether target is reachable from rt through pointers,
+// slices, arrays, maps and struct fields.
+func containsType(rt, target reflect.Type) bool {
+	return containsTypeVisiting(rt, target, map[reflect.Type]bool{})
+}
+
+func containsTypeVisiting(rt, target reflect.Type, visited map[reflect.Type]bool) bool {
+	if rt == target {
+		return true
+	}
+	if visited[rt] {
+		return false
+	}
+	visited[rt] = true
+	switch rt.Kind() {
+	case reflect.Ptr, reflect.Slice, reflect.Array, reflect.Map:
+		return containsTypeVisiting(rt.Elem(), target, visited)
+	case reflect.Struct:
+		for i := 0; i < rt.NumField(); i++ {
+			if containsTypeVisiting(rt.Field(i).Type, target, visited) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func implements(rt reflect.Type, iface reflect.Type) bool {
+	return rt.Implements(iface) || reflect.PtrTo(rt).Implements(iface)
+}
+
+// jsonField is a struct field as seen by encoding/json.
+type jsonField struct {
+	reflect.StructField
+	name      string
+	stringOpt bool
+	depth     int
+	tagged    bool
+}
+
+// jsonFields returns the fields of a struct that encoding/json encodes,
+// including those promoted from embedded structs, in declaration order.
+func jsonFields(rt reflect.Type) []jsonField {
+	var fields []jsonField
+	collectJSONFields(rt, 0, nil, &fields)
+
+	// resolve conflicts following encoding/json: the shallowest field wins,
+	// then the tagged field; otherwise all conflicting fields are dropped
+	var resolved []jsonField
+	for i, field := range fields {
+		dominant := true
+		for j, other := range fields {
+			if i == j || other.name != field.name || other.depth > field.depth {
+				continue
+			}
+			if other.depth < field.depth || other.tagged || !field.tagged {
+				dominant = false
+				break
+			}
+		}
+		if dominant {
+			resolved = append(resolved, field)
+		}
+	}
+	return resolved
+}
+
+func collectJSONFields(rt reflect.Type, depth int, index []int, fields *[]jsonField) {
+	for i := 0; i < rt.NumField(); i++ {
+		field := rt.Field(i)
+		tag := field.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, opts, _ := strings.Cut(tag, ",")
+
+		fieldType := field.Type
+		if fieldType.Kind() == reflect.Ptr {
+			fieldType = fieldType.Elem()
+		}
+		if field.Anonymous && name == "" && fieldType.Kind() == reflect.Struct {
+			collectJSONFields(fieldType, depth+1, append(append([]int(nil), index...), i), fields)
+			continue
+		}
+		if !field.IsExported() {
+			continue
+		}
+
+		field.Index = append(append([]int(nil), index...), i)
+		f := jsonField{
+			StructField: field,
+			name:        name,
+			depth:       depth,
+			tagged:      name != "",
+		}
+		if f.name == "" {
+			f.name = field.Name
+		}
+		for _, opt := range strings.Split(opts, ",") {
+			if opt == "string" {
+				f.stringOpt = true
+			}
+		}
+		*fields = append(*fields, f)
+	}
+}
@@ -0,0 +1,110 @@
+package prototype_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/aoldershaw/prototype-sdk-go"
+	"github.com/stretchr/testify/require"
+)
+
+type Repository struct {
+	URI        string `json:"uri" prototype:"required"`
+	PrivateKey string `json:"private_key,omitempty"`
+}
+
+type Branch struct {
+	Repository
+	Branch string `json:"branch" prototype:"required"`
+}
+
+type BuildOutput struct {
+	Image  prototype.Artifact   `json:"image"`
+	Layers []prototype.Artifact `json:"layers"`
+	Labels map[string]string    `json:"labels"`
+	Hidden string               `json:"-"`
+	Port   int                  `json:"port,string"`
+}
+
+func TestSchemaOf(t *testing.T) {
+	for _, tt := range []struct {
+		desc     string
+		value    interface{}
+		expected string
+	}{
+		{
+			desc:  "embedded struct",
+			value: Branch{},
+			expected: `{
+				"$schema": "https://json-schema.org/draft/2020-12/schema",
+				"title": "Branch",
+				"type": "object",
+				"properties": {
+					"uri": {"type": "string"},
+					"private_key": {"type": "string"},
+					"branch": {"type": "string"}
+				},
+				"required": ["uri", "branch"]
+			}`,
+		},
+		{
+			desc:  "artifacts",
+			value: BuildOutput{},
+			expected: `{
+				"$schema": "https://json-schema.org/draft/2020-12/schema",
+				"title": "BuildOutput",
+				"type": "object",
+				"properties": {
+					"image": {
+						"type": "object",
+						"properties": {
+							"artifact": {"type": "string"},
+							"digest": {"type": "string", "pattern": "^sha256:[0-9a-f]{64}$"}
+						},
+						"required": ["artifact"],
+						"additionalProperties": {"not": {}}
+					},
+					"layers": {
+						"type": "array",
+						"items": {
+							"type": "object",
+							"properties": {
+							"artifact": {"type": "string"},
+							"digest": {"type": "string", "pattern": "^sha256:[0-9a-f]{64}$"}
+						},
+							"required": ["artifact"],
+							"additionalProperties": {"not": {}}
+						}
+					},
+					"labels": {"type": "object", "additionalProperties": {"type": "string"}},
+					"port": {"type": "string"}
+				}
+			}`,
+		},
+	} {
+		t.Run(tt.desc, func(t *testing.T) {
+			schema, err := json.Marshal(prototype.SchemaOf(tt.value))
+			require.NoError(t, err)
+			require.JSONEq(t, tt.expected, string(schema))
+		})
+	}
+}
+
+func TestPrototypeSchemas(t *testing.T) {
+	proto := prototype.New(
+		prototype.WithObject(SimpleObject{},
+			prototype.WithMessage("msg1", noop),
+			prototype.WithMessage("msg2", func(_ SimpleObject, _ SimpleParams) []prototype.MessageResponse {
+				return nil
+			}),
+		))
+
+	schemas := proto.Schemas()
+	require.Len(t, schemas, 1)
+	require.Equal(t, "SimpleObject", schemas[0].Name)
+	require.Equal(t, []string{"foo"}, schemas[0].Schema.Required)
+	require.Len(t, schemas[0].Messages, 2)
+	require.Nil(t, schemas[0].Messages[0].Request)
+	require.Equal(t, "SimpleParams", schemas[0].Messages[1].Request.Title)
+	require.Equal(t, []string{"baz"}, schemas[0].Messages[1].Request.Required)
+}
@@ -0,0 +1,218 @@
+package prototype
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+)
+
+// ServerSocketEnv is the environment variable that may be used to configure
+// the server socket that Execute forwards requests to (see WithServerSocket).
+const ServerSocketEnv = "PROTOTYPE_SERVER_SOCKET"
+
+// WithServerSocket makes Execute forward requests to a server listening on the
+// Unix socket at socketPath (see Serve), avoiding the cost of starting up for
+// each request. If the server cannot be reached, the request is handled in
+// process.
+func WithServerSocket(socketPath string) Option {
+	return func(p *Prototype) {
+		p.serverSocket = socketPath
+	}
+}
+
+func (p Prototype) socketPath(env Environment) string {
+	if socketPath := env.Getenv(ServerSocketEnv); socketPath != "" {
+		return socketPath
+	}
+	return p.serverSocket
+}
+
+// serverRequest is the body of a request to a server. If Message is empty, an
+// InfoRequest is handled. Artifacts are resolved against Dir, the working
+// directory of the client, rather than that of the server.
+type serverRequest struct {
+	Message string                 `json:"message,omitempty"`
+	Object  map[string]interface{} `json:"object"`
+	Dir     string                 `json:"dir,omitempty"`
+}
+
+// Serve handles requests from a Client (or from Execute, see
+// WithServerSocket) on listener until it is closed. Requests are made over
+// HTTP, and the response body is the JSON stream that Execute would write to
+// the `response_path`.
+//
+// Artifacts are resolved against the working directory of the client (see
+// WorkingDir), so the server may run in a different directory than its
+// clients. The context passed to message handlers is canceled if the client
+// goes away.
+func (p Prototype) Serve(listener net.Listener) error {
+	return http.Serve(listener, http.HandlerFunc(p.serveHTTP))
+}
+
+func (p Prototype) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+
+	var request serverRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		writeStream(w, func(*json.Encoder) error {
+			return &Error{Code: ErrorCodeInvalidRequest, Message: fmt.Sprintf("invalid json request: %s", err), err: err}
+		})
+		return
+	}
+
+	ctx := r.Context()
+	if request.Dir != "" {
+		ctx = ContextWithWorkingDir(ctx, request.Dir)
+	}
+	writeStream(flushWriter{w}, func(encoder *json.Encoder) error {
+		return p.respond(ctx, request.Message, request.Object, encoder, os.Stderr)
+	})
+}
+
+// flushWriter flushes each write, so that responses are streamed to the client
+// as they are produced.
+type flushWriter struct {
+	w http.ResponseWriter
+}
+
+func (f flushWriter) Write(p []byte) (int, error) {
+	n, err := f.w.Write(p)
+	if flusher, ok := f.w.(http.Flusher); ok {
+		flusher.Flush()
+	}
+	return n, err
+}
+
+type serverUnavailableError struct {
+	err error
+}
+
+func (e serverUnavailableError) Error() string {
+	return fmt.Sprintf("server unavailable: %s", e.err)
+}
+
+func (e serverUnavailableError) Unwrap() error {
+	return e.err
+}
+
+// Client makes requests to a prototype server (see Serve). Artifacts are
+// resolved by the server against the working directory of the context passed
+// to each request (see WorkingDir).
+type Client struct {
+	httpClient *http.Client
+}
+
+// NewClient returns a Client for the server listening on the Unix socket at
+// socketPath.
+func NewClient(socketPath string) Client {
+	dialer := &net.Dialer{}
+	return Client{
+		httpClient: &http.Client{
+			Transport: &http.Transport{
+				DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+					conn, err := dialer.DialContext(ctx, "unix", socketPath)
+					if err != nil {
+						return nil, serverUnavailableError{err: err}
+					}
+					return conn, nil
+				},
+			},
+		},
+	}
+}
+
+// Info is like Prototype.Info, but is handled by the server.
+func (c Client) Info(ctx context.Context, request InfoRequest) (InfoResponse, error) {
+	var response InfoResponse
+	err := c.do(ctx, "", request.Object, func(payload json.RawMessage) error {
+		return json.Unmarshal(payload, &response)
+	})
+	return response, err
+}
+
+// Run is like Prototype.RunContext, but is handled by the server. Failures
+// are returned as an *Error.
+func (c Client) Run(ctx context.Context, message string, request MessageRequest) ([]MessageResponse, error) {
+	var responses []MessageResponse
+	err := c.do(ctx, message, request.Object, func(payload json.RawMessage) error {
+		var response MessageResponse
+		if err := json.Unmarshal(payload, &response); err != nil {
+			return err
+		}
+		responses = append(responses, response)
+		return nil
+	})
+	return responses, err
+}
+
+// forward makes a request to the server, writing the responses to encoder.
+func (c Client) forward(ctx context.Context, message string, object map[string]interface{}, encoder *json.Encoder) error {
+	return c.do(ctx, message, object, func(payload json.RawMessage) error {
+		return encoder.Encode(payload)
+	})
+}
+
+// do makes a request to the server, and calls handle with each value in the
+// response stream. An ErrorResponse is returned as an *Error.
+func (c Client) do(ctx context.Context, message string, object map[string]interface{}, handle func(json.RawMessage) error) error {
+	dir, err := filepath.Abs(WorkingDir(ctx))
+	if err != nil {
+		return &Error{Code: ErrorCodeInternal, Message: fmt.Sprintf("get working directory: %s", err), err: err}
+	}
+	body, err := json.Marshal(serverRequest{Message: message, Object: object, Dir: dir})
+	if err != nil {
+		return &Error{Code: ErrorCodeInvalidRequest, Message: fmt.Sprintf("marshal request: %s", err), err: err}
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, "http://prototype/", bytes.NewReader(body))
+	if err != nil {
+		return &Error{Code: ErrorCodeInternal, Message: fmt.Sprintf("create request: %s", err), err: err}
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		var unavailableErr serverUnavailableError
+		if errors.As(err, &unavailableErr) {
+			return unavailableErr
+		}
+		return &Error{Code: ErrorCodeInternal, Message: fmt.Sprintf("request server: %s", err), err: err}
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusBadRequest {
+		return &Error{Code: ErrorCodeInternal, Message: fmt.Sprintf("server responded with %s", resp.Status)}
+	}
+
+	decoder := json.NewDecoder(resp.Body)
+	for {
+		var payload json.RawMessage
+		if err := decoder.Decode(&payload); err != nil {
+			if err == io.EOF {
+				break
+			}
+			if ctxErr := ctx.Err(); ctxErr != nil {
+				return &Error{Code: ErrorCodeCanceled, Message: ctxErr.Error(), Retryable: true, err: ctxErr}
+			}
+			return &Error{Code: ErrorCodeInternal, Message: fmt.Sprintf("read response: %s", err), err: err}
+		}
+		var errResponse ErrorResponse
+		if json.Unmarshal(payload, &errResponse) == nil && errResponse.Error != nil {
+			return errResponse.Error
+		}
+		if err := handle(payload); err != nil {
+			return &Error{Code: ErrorCodeInternal, Message: fmt.Sprintf("handle response: %s", err), err: err}
+		}
+	}
+	return nil
+}
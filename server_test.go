@@ -0,0 +1,75 @@
+package prototype_test
+
+import (
+	"context"
+	"errors"
+	"net"
+	"path/filepath"
+	"testing"
+
+	"github.com/aoldershaw/prototype-sdk-go"
+	"github.com/stretchr/testify/require"
+)
+
+func TestServe(t *testing.T) {
+	socketPath := filepath.Join(t.TempDir(), "prototype.sock")
+	listener, err := net.Listen("unix", socketPath)
+	require.NoError(t, err)
+
+	proto := prototype.New(
+		prototype.WithIcon("mdi:test"),
+		prototype.WithObject(SimpleObject{},
+			prototype.WithMessage("msg", func(object SimpleObject, emitter prototype.Emitter) error {
+				for _, v := range []string{"a", "b"} {
+					if err := emitter.Emit(prototype.MessageResponse{Object: map[string]interface{}{"v": object.Foo + v}}); err != nil {
+						return err
+					}
+				}
+				return nil
+			}),
+			prototype.WithMessage("fail", func(SimpleObject) ([]prototype.MessageResponse, error) {
+				return nil, errors.New("oh no")
+			}),
+		),
+	)
+	go proto.Serve(listener)
+	defer listener.Close()
+
+	client := prototype.NewClient(socketPath)
+	ctx := context.Background()
+	object := map[string]interface{}{"foo": "abc"}
+
+	t.Run("info", func(t *testing.T) {
+		info, err := client.Info(ctx, prototype.InfoRequest{Object: object})
+		require.NoError(t, err)
+		require.Equal(t, "mdi:test", info.Icon)
+		require.ElementsMatch(t, []string{"msg", "fail"}, info.Messages)
+	})
+
+	t.Run("run", func(t *testing.T) {
+		responses, err := client.Run(ctx, "msg", prototype.MessageRequest{Object: object})
+		require.NoError(t, err)
+		require.Equal(t, []prototype.MessageResponse{
+			{Object: map[string]interface{}{"v": "abca"}},
+			{Object: map[string]interface{}{"v": "abcb"}},
+		}, responses)
+	})
+
+	t.Run("handler error", func(t *testing.T) {
+		_, err := client.Run(ctx, "fail", prototype.MessageRequest{Object: object})
+		protoErr := prototype.AsError(err)
+		require.Equal(t, prototype.ErrorCodeHandler, protoErr.Code)
+		require.Equal(t, "SimpleObject", protoErr.ObjectType)
+		require.Contains(t, protoErr.Message, "oh no")
+	})
+
+	t.Run("no match", func(t *testing.T) {
+		_, err := client.Run(ctx, "msg", prototype.MessageRequest{Object: map[string]interface{}{"bar": 1}})
+		require.Equal(t, 3, prototype.ExitCode(err))
+	})
+
+	t.Run("unavailable", func(t *testing.T) {
+		_, err := prototype.NewClient(filepath.Join(t.TempDir(), "missing.sock")).Run(ctx, "msg", prototype.MessageRequest{Object: object})
+		require.Error(t, err)
+	})
+}
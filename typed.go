@@ -0,0 +1,92 @@
+package prototype
+
+import (
+	"context"
+	"reflect"
+)
+
+// TypedObjectOption is an ObjectOption that may only be applied to objects of
+// type Obj. It is used by ObjectOf to catch mismatches between an object and
+// its messages at compile time.
+type TypedObjectOption[Obj any] func(*objectWrapper)
+
+// NoRequest may be used as the request type of a Message that does not take a
+// request.
+type NoRequest struct{}
+
+// ObjectOf is a type-safe alternative to WithObject. Obj must be a concrete
+// (non-interface) type.
+//
+//	prototype.ObjectOf[Repository](
+//		prototype.Message("list", Repository.ListBranches),
+//	)
+func ObjectOf[Obj any](options ...TypedObjectOption[Obj]) Option {
+	objectOptions := make([]ObjectOption, len(options))
+	for i, opt := range options {
+		objectOptions[i] = ObjectOption(opt)
+	}
+	var object Obj
+	return WithObject(object, objectOptions...)
+}
+
+// ObjectOptions allows untyped ObjectOptions to be passed to ObjectOf.
+func ObjectOptions[Obj any](options ...ObjectOption) TypedObjectOption[Obj] {
+	return func(o *objectWrapper) {
+		for _, opt := range options {
+			opt(o)
+		}
+	}
+}
+
+// Message is a type-safe alternative to WithMessage. If the message does not
+// take a request, Req should be NoRequest.
+func Message[Obj, Req any](name string, executeFunc func(Obj, Req) ([]MessageResponse, error), options ...MessageOption) TypedObjectOption[Obj] {
+	return MessageContext(name, func(_ context.Context, object Obj, request Req) ([]MessageResponse, error) {
+		return executeFunc(object, request)
+	}, options...)
+}
+
+// MessageContext is like Message, but the executeFunc accepts a
+// context.Context (see WithMessage).
+func MessageContext[Obj, Req any](name string, executeFunc func(context.Context, Obj, Req) ([]MessageResponse, error), options ...MessageOption) TypedObjectOption[Obj] {
+	requestType := typedRequestType[Req]()
+	return func(o *objectWrapper) {
+		execute := func(ctx context.Context, object Object, request Request) ([]MessageResponse, error) {
+			// request is nil when Req is NoRequest
+			req, _ := request.(Req)
+			return executeFunc(ctx, object.(Obj), req)
+		}
+		o.messages = append(o.messages, newMessage(name, requestType, execute, options))
+	}
+}
+
+// MessageStream is a type-safe alternative to WithMessage for streaming
+// handlers, which emit each response as it is produced (see Emitter). If the
+// message does not take a request, Req should be NoRequest.
+func MessageStream[Obj, Req any](name string, executeFunc func(Obj, Req, Emitter) error, options ...MessageOption) TypedObjectOption[Obj] {
+	return MessageStreamContext(name, func(_ context.Context, object Obj, request Req, emitter Emitter) error {
+		return executeFunc(object, request, emitter)
+	}, options...)
+}
+
+// MessageStreamContext is like MessageStream, but the executeFunc accepts a
+// context.Context (see WithMessage).
+func MessageStreamContext[Obj, Req any](name string, executeFunc func(context.Context, Obj, Req, Emitter) error, options ...MessageOption) TypedObjectOption[Obj] {
+	requestType := typedRequestType[Req]()
+	return func(o *objectWrapper) {
+		execute := streaming(func(ctx context.Context, object Object, request Request, emitter Emitter) error {
+			req, _ := request.(Req)
+			return executeFunc(ctx, object.(Obj), req, emitter)
+		})
+		o.messages = append(o.messages, newMessage(name, requestType, execute, options))
+	}
+}
+
+// typedRequestType returns the request type of a typed message, which is nil
+// if Req is NoRequest.
+func typedRequestType[Req any]() reflect.Type {
+	if t := reflect.TypeOf((*Req)(nil)).Elem(); t != reflect.TypeOf(NoRequest{}) {
+		return t
+	}
+	return nil
+}
@@ -0,0 +1,281 @@
+package prototype
+
+import (
+	"fmt"
+	"net/url"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// fieldTag is a parsed `prototype` struct tag. The tag is a comma separated
+// list of options (see WithObject for the supported options).
+//
+// With the exception of required and nonempty, validation options are only
+// checked when the field is set.
+type fieldTag struct {
+	required bool
+	nonempty bool
+	min      *float64
+	max      *float64
+	length   *int
+	oneof    []string
+	url      bool
+	semver   bool
+	duration bool
+	pattern  *regexp.Regexp
+	file     bool
+	dir      bool
+
+	defaultValue *string
+}
+
+var fieldTagCache sync.Map
+
+// parseFieldTag parses the `prototype` tag of a struct field.
+func parseFieldTag(field reflect.StructField) (fieldTag, error) {
+	raw := field.Tag.Get("prototype")
+	if cached, ok := fieldTagCache.Load(raw); ok {
+		return cached.(fieldTag), nil
+	}
+
+	var tag fieldTag
+	for _, opt := range splitTagOptions(raw) {
+		key, value, hasValue := strings.Cut(opt, "=")
+
+		var err error
+		switch key {
+		case "required":
+			tag.required = true
+		case "nonempty":
+			tag.nonempty = true
+		case "url":
+			tag.url = true
+		case "semver":
+			tag.semver = true
+		case "duration":
+			tag.duration = true
+		case "file":
+			tag.file = true
+		case "dir":
+			tag.dir = true
+		case "min", "max":
+			var n float64
+			n, err = strconv.ParseFloat(value, 64)
+			if key == "min" {
+				tag.min = &n
+			} else {
+				tag.max = &n
+			}
+		case "len":
+			var n int
+			n, err = strconv.Atoi(value)
+			tag.length = &n
+		case "oneof":
+			tag.oneof = strings.Split(value, "|")
+		case "pattern":
+			tag.pattern, err = regexp.Compile(value)
+		case "default":
+			tag.defaultValue = &value
+		default:
+			if hasValue || key != "" {
+				err = fmt.Errorf("unknown option")
+			}
+		}
+		if err != nil {
+			return fieldTag{}, fmt.Errorf("invalid prototype tag option %q on field %s: %w", opt, field.Name, err)
+		}
+	}
+
+	fieldTagCache.Store(field.Tag.Get("prototype"), tag)
+	return tag, nil
+}
+
+var fieldTagKeys = map[string]bool{
+	"required": true, "nonempty": true, "url": true, "semver": true,
+	"duration": true, "min": true, "max": true, "len": true, "oneof": true,
+	"pattern": true, "default": true, "file": true, "dir": true,
+}
+
+// splitTagOptions splits the tag on commas. Since the values of pattern and
+// default may contain commas, a comma that is not followed by a known option
+// is considered part of the preceding value.
+func splitTagOptions(raw string) []string {
+	if raw == "" {
+		return nil
+	}
+	var opts []string
+	for _, part := range strings.Split(raw, ",") {
+		key, _, _ := strings.Cut(part, "=")
+		if len(opts) > 0 && !fieldTagKeys[key] {
+			prevKey, _, _ := strings.Cut(opts[len(opts)-1], "=")
+			if prevKey == "pattern" || prevKey == "default" {
+				opts[len(opts)-1] += "," + part
+				continue
+			}
+		}
+		opts = append(opts, part)
+	}
+	return opts
+}
+
+// mustValidateTags panics if any `prototype` tags reachable from rt are
+// invalid, so that misconfigured objects and requests fail at startup.
+func mustValidateTags(rt reflect.Type) {
+	if err := validateTags(rt, map[reflect.Type]bool{}); err != nil {
+		panic(fmt.Errorf("%s: %w", rt, err))
+	}
+}
+
+func validateTags(rt reflect.Type, visited map[reflect.Type]bool) error {
+	if rt == nil || visited[rt] {
+		return nil
+	}
+	visited[rt] = true
+	switch rt.Kind() {
+	case reflect.Ptr, reflect.Slice, reflect.Array, reflect.Map:
+		return validateTags(rt.Elem(), visited)
+	case reflect.Struct:
+		for i := 0; i < rt.NumField(); i++ {
+			field := rt.Field(i)
+			tag, err := parseFieldTag(field)
+			if err != nil {
+				return err
+			}
+			if (tag.file || tag.dir) && !isArtifactField(field.Type) {
+				return fmt.Errorf("invalid prototype tag on field %s: file and dir may only be used on artifacts", field.Name)
+			}
+			if tag.file && tag.dir {
+				return fmt.Errorf("invalid prototype tag on field %s: file and dir are mutually exclusive", field.Name)
+			}
+			if tag.defaultValue != nil {
+				if _, err := parseDefault(field.Type, *tag.defaultValue); err != nil {
+					return fmt.Errorf("invalid default on field %s: %w", field.Name, err)
+				}
+			}
+			if err := validateTags(field.Type, visited); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+type validationError struct {
+	// path is the JSON path of the field.
+	path   string
+	reason string
+}
+
+func (e validationError) Error() string {
+	return fmt.Sprintf("prototype: field %q %s", e.path, e.reason)
+}
+
+var semverRegexp = regexp.MustCompile(`^v?(0|[1-9]\d*)\.(0|[1-9]\d*)\.(0|[1-9]\d*)(?:-((?:0|[1-9]\d*|\d*[a-zA-Z-][0-9a-zA-Z-]*)(?:\.(?:0|[1-9]\d*|\d*[a-zA-Z-][0-9a-zA-Z-]*))*))?(?:\+([0-9a-zA-Z-]+(?:\.[0-9a-zA-Z-]+)*))?$`)
+
+// validate checks the value of a field against the tag. It returns a
+// human readable reason if the value is invalid. The required option is
+// checked separately, since it results in a requiredFieldNotSetError.
+func (t fieldTag) validate(rv reflect.Value) (string, bool) {
+	if rv.IsZero() {
+		if t.nonempty {
+			return "must not be empty", false
+		}
+		return "", true
+	}
+	for rv.Kind() == reflect.Ptr || rv.Kind() == reflect.Interface {
+		if rv.IsNil() {
+			return "", true
+		}
+		rv = rv.Elem()
+	}
+
+	size, hasSize := valueSize(rv)
+	if t.nonempty && hasSize && size == 0 {
+		return "must not be empty", false
+	}
+	if t.length != nil && hasSize && size != *t.length {
+		return fmt.Sprintf("must have length %d", *t.length), false
+	}
+
+	number, isNumber := valueNumber(rv)
+	if t.min != nil {
+		if isNumber && number < *t.min {
+			return fmt.Sprintf("must be at least %v", *t.min), false
+		}
+		if hasSize && float64(size) < *t.min {
+			return fmt.Sprintf("must have length at least %v", *t.min), false
+		}
+	}
+	if t.max != nil {
+		if isNumber && number > *t.max {
+			return fmt.Sprintf("must be at most %v", *t.max), false
+		}
+		if hasSize && float64(size) > *t.max {
+			return fmt.Sprintf("must have length at most %v", *t.max), false
+		}
+	}
+
+	if len(t.oneof) > 0 {
+		str := fmt.Sprint(rv.Interface())
+		found := false
+		for _, allowed := range t.oneof {
+			if str == allowed {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return fmt.Sprintf("must be one of %s", strings.Join(t.oneof, ", ")), false
+		}
+	}
+
+	if rv.Kind() != reflect.String {
+		return "", true
+	}
+	str := rv.String()
+	if t.pattern != nil && !t.pattern.MatchString(str) {
+		return fmt.Sprintf("must match %s", t.pattern), false
+	}
+	if t.url {
+		if u, err := url.Parse(str); err != nil || u.Scheme == "" || (u.Host == "" && u.Opaque == "") {
+			return "must be an absolute URL", false
+		}
+	}
+	if t.semver && !semverRegexp.MatchString(str) {
+		return "must be a semantic version", false
+	}
+	if t.duration {
+		if _, err := time.ParseDuration(str); err != nil {
+			return "must be a duration", false
+		}
+	}
+	return "", true
+}
+
+// valueSize returns the length of strings (in runes), slices, arrays and maps.
+func valueSize(rv reflect.Value) (int, bool) {
+	switch rv.Kind() {
+	case reflect.String:
+		return utf8.RuneCountInString(rv.String()), true
+	case reflect.Slice, reflect.Array, reflect.Map:
+		return rv.Len(), true
+	}
+	return 0, false
+}
+
+func valueNumber(rv reflect.Value) (float64, bool) {
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(rv.Int()), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(rv.Uint()), true
+	case reflect.Float32, reflect.Float64:
+		return rv.Float(), true
+	}
+	return 0, false
+}
@@ -0,0 +1,152 @@
+package prototype_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/aoldershaw/prototype-sdk-go"
+	"github.com/stretchr/testify/require"
+)
+
+type ValidatedObject struct {
+	Name     string            `json:"name" prototype:"required,min=2,max=5"`
+	Count    int               `json:"count,omitempty" prototype:"min=1,max=10"`
+	Code     string            `json:"code,omitempty" prototype:"len=3"`
+	Mode     string            `json:"mode,omitempty" prototype:"oneof=fast|slow"`
+	URL      string            `json:"url,omitempty" prototype:"url"`
+	Version  string            `json:"version,omitempty" prototype:"semver"`
+	Timeout  string            `json:"timeout,omitempty" prototype:"duration"`
+	Tags     []string          `json:"tags" prototype:"nonempty"`
+	Labels   map[string]string `json:"labels,omitempty" prototype:"max=1"`
+	Branch   string            `json:"branch,omitempty" prototype:"pattern=^[a-z]{1,3}$"`
+	Children []struct {
+		Weight float64 `json:"weight" prototype:"max=1.5"`
+	} `json:"children,omitempty"`
+}
+
+func TestValidation(t *testing.T) {
+	valid := func() map[string]interface{} {
+		return map[string]interface{}{
+			"name": "abc",
+			"tags": []string{"a"},
+		}
+	}
+	with := func(key string, value interface{}) map[string]interface{} {
+		object := valid()
+		object[key] = value
+		return object
+	}
+
+	for _, tt := range []struct {
+		desc          string
+		object        map[string]interface{}
+		expectedField string
+	}{
+		{desc: "valid", object: valid()},
+		{desc: "all options valid", object: map[string]interface{}{
+			"name":     "abc",
+			"count":    10,
+			"code":     "xyz",
+			"mode":     "slow",
+			"url":      "https://example.com/repo.git",
+			"version":  "v1.2.3-rc.1",
+			"timeout":  "1m30s",
+			"tags":     []string{"a"},
+			"labels":   map[string]string{"a": "b"},
+			"branch":   "dev",
+			"children": []map[string]interface{}{{"weight": 1.5}},
+		}},
+		{desc: "required", object: with("name", ""), expectedField: "name"},
+		{desc: "min length", object: with("name", "a"), expectedField: "name"},
+		{desc: "max length", object: with("name", "abcdef"), expectedField: "name"},
+		{desc: "min value", object: with("count", -1), expectedField: "count"},
+		{desc: "max value", object: with("count", 11), expectedField: "count"},
+		{desc: "len", object: with("code", "ab"), expectedField: "code"},
+		{desc: "oneof", object: with("mode", "medium"), expectedField: "mode"},
+		{desc: "url", object: with("url", "not a url"), expectedField: "url"},
+		{desc: "semver", object: with("version", "1.2"), expectedField: "version"},
+		{desc: "duration", object: with("timeout", "forever"), expectedField: "timeout"},
+		{desc: "nonempty nil", object: with("tags", nil), expectedField: "tags"},
+		{desc: "nonempty empty", object: with("tags", []string{}), expectedField: "tags"},
+		{desc: "max map size", object: with("labels", map[string]string{"a": "b", "c": "d"}), expectedField: "labels"},
+		{desc: "pattern", object: with("branch", "main"), expectedField: "branch"},
+		{desc: "nested", object: with("children", []map[string]interface{}{{"weight": 1}, {"weight": 2}}), expectedField: "children[1].weight"},
+	} {
+		t.Run(tt.desc, func(t *testing.T) {
+			proto := prototype.New(
+				prototype.WithObject(ValidatedObject{},
+					prototype.WithMessage("msg", noop),
+				))
+
+			_, err := proto.Run("msg", prototype.MessageRequest{Object: tt.object})
+			if tt.expectedField == "" {
+				require.NoError(t, err)
+				return
+			}
+			require.Error(t, err)
+			require.Equal(t, tt.expectedField, prototype.AsError(err).Field)
+		})
+	}
+}
+
+func TestValidationNumericBoundsOfZero(t *testing.T) {
+	type Deployment struct {
+		Replicas int  `json:"replicas,omitempty" prototype:"min=1"`
+		Surge    *int `json:"surge,omitempty" prototype:"min=1"`
+	}
+	proto := prototype.New(
+		prototype.WithObject(Deployment{},
+			prototype.WithMessage("msg", noop),
+		))
+
+	// like the other options, bounds are only checked when the field is set
+	for _, object := range []map[string]interface{}{
+		{},
+		{"replicas": 0},
+		{"replicas": 2},
+	} {
+		_, err := proto.Run("msg", prototype.MessageRequest{Object: object})
+		require.NoError(t, err)
+	}
+
+	// a pointer is set even if it points to zero
+	_, err := proto.Run("msg", prototype.MessageRequest{Object: map[string]interface{}{"surge": 0}})
+	require.Error(t, err)
+	require.Equal(t, "surge", prototype.AsError(err).Field)
+}
+
+func TestValidationInvalidTag(t *testing.T) {
+	type BadTag struct {
+		Count int `json:"count" prototype:"min=lots"`
+	}
+	require.Panics(t, func() {
+		prototype.New(prototype.WithObject(BadTag{}))
+	})
+}
+
+func TestValidationSchema(t *testing.T) {
+	properties := prototype.SchemaOf(ValidatedObject{}).Properties
+	require.NotEmpty(t, properties["version"].Pattern)
+	delete(properties, "version")
+
+	schema, err := json.Marshal(properties)
+	require.NoError(t, err)
+	require.JSONEq(t, `{
+		"name": {"type": "string", "minLength": 2, "maxLength": 5},
+		"count": {"type": "integer", "minimum": 1, "maximum": 10},
+		"code": {"type": "string", "minLength": 3, "maxLength": 3},
+		"mode": {"type": "string", "enum": ["fast", "slow"]},
+		"url": {"type": "string", "format": "uri"},
+		"timeout": {"type": "string"},
+		"tags": {"type": "array", "items": {"type": "string"}, "minItems": 1},
+		"labels": {"type": "object", "additionalProperties": {"type": "string"}, "maxProperties": 1},
+		"branch": {"type": "string", "pattern": "^[a-z]{1,3}$"},
+		"children": {
+			"type": "array",
+			"items": {
+				"type": "object",
+				"properties": {"weight": {"type": "number", "maximum": 1.5}}
+			}
+		}
+	}`, string(schema))
+}